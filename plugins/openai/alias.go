@@ -0,0 +1,53 @@
+package openai
+
+import (
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// DefineAlias defines a model named alias that generates with the target model, as [Config.Aliases] does.
+// The target may also be a model defined with [Plugin.DefineModel], whose capabilities the alias shares.
+func (p *Plugin) DefineAlias(alias, target string) (ai.Model, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, err := p.defineAlias(alias, target)
+	if err != nil {
+		return nil, fmt.Errorf("%s.DefineAlias: %w", provider, err)
+	}
+	return m, nil
+}
+
+// defineAlias defines a model named alias that generates with the target model.
+// The capabilities of the alias are those of the target, as defined by the plugin or described by the catalog.
+//
+// requires p.mu
+func (p *Plugin) defineAlias(alias, target string) (ai.Model, error) {
+	if p.IsDefinedModel(alias) {
+		return nil, fmt.Errorf("alias %q: a model with this name is already defined", alias)
+	}
+	info, err := p.aliasTarget(alias, target)
+	if err != nil {
+		return nil, err
+	}
+	return p.defineAliasFor(alias, target, info), nil
+}
+
+// aliasTarget returns the description of the target of the alias.
+//
+// requires p.mu
+func (p *Plugin) aliasTarget(alias, target string) (ModelInfo, error) {
+	if info, ok := p.definedModels[target]; ok {
+		return info, nil
+	}
+	info, ok := p.LookupModelInfo(target)
+	if !ok || info.Type != ModelTypeChat {
+		return ModelInfo{}, fmt.Errorf("alias %q: unknown chat model %q", alias, target)
+	}
+	return info, nil
+}
+
+// requires p.mu
+func (p *Plugin) defineAliasFor(alias, target string, info ModelInfo) ai.Model {
+	return p.defineModelFor(alias, target, labelPrefix+" - "+alias+" ("+target+")", info)
+}
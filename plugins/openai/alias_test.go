@@ -0,0 +1,104 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+func TestDefineAlias(t *testing.T) {
+	var gotModel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		gotModel = body.Model
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"created": 1,
+			"model": "gpt-4o-2024-08-06",
+			"system_fingerprint": "fp_1",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hi"}}],
+			"usage": {"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2}
+		}`)
+	}))
+	defer srv.Close()
+
+	p := &Plugin{
+		provider: "test-alias",
+		client: goopenai.NewClient(
+			option.WithAPIKey("test"),
+			option.WithBaseURL(srv.URL),
+			option.WithMaxRetries(0),
+		),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m, err := p.defineAlias("test-default-chat", "gpt-4o-2024-08-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := m.Generate(context.Background(), &ai.GenerateRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello")},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotModel != "gpt-4o-2024-08-06" {
+		t.Errorf("request model = %q, want %q", gotModel, "gpt-4o-2024-08-06")
+	}
+	custom, ok := resp.Custom.(*ResponseCustom)
+	if !ok {
+		t.Fatalf("response custom = %#v, want a *ResponseCustom", resp.Custom)
+	}
+	if custom.Model != "gpt-4o-2024-08-06" || custom.SystemFingerprint != "fp_1" {
+		t.Errorf("response custom model = %q, system fingerprint = %q, want %q, %q", custom.Model, custom.SystemFingerprint, "gpt-4o-2024-08-06", "fp_1")
+	}
+	if custom.Completion == nil || custom.Completion.ID != "chatcmpl-1" {
+		t.Errorf("response custom completion = %#v, want the raw response", custom.Completion)
+	}
+
+	// gpt-4o-2024-08-06 costs $2.5 per 1M input tokens and $10 per 1M output tokens.
+	if want := (2.5 + 10) / 1e6; custom.Cost != want {
+		t.Errorf("response cost = %v, want %v", custom.Cost, want)
+	}
+
+	if _, err := p.defineAlias("test-default-chat", "gpt-4o"); err == nil {
+		t.Error("p.defineAlias() expected an error for an alias that is already defined")
+	}
+	if _, err := p.defineAlias("test-unknown-alias", "unknown-model"); err == nil {
+		t.Error("p.defineAlias() expected an error for an unknown target")
+	}
+	if _, err := p.defineAlias("test-embedding-alias", "text-embedding-3-small"); err == nil {
+		t.Error("p.defineAlias() expected an error for an embedding target")
+	}
+}
+
+func TestDefineAliasOfDefinedModel(t *testing.T) {
+	p := &Plugin{provider: "test-alias-defined"}
+	if _, err := p.DefineAlias("test-deployment-alias", "my-deployment"); err == nil {
+		t.Error("DefineAlias() expected an error for a model that is not defined")
+	}
+	if _, err := p.DefineModel("my-deployment", &BasicText); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DefineAlias("test-deployment-alias", "my-deployment"); err != nil {
+		t.Fatalf("DefineAlias() error = %v", err)
+	}
+	if !p.IsDefinedModel("test-deployment-alias") {
+		t.Error("the alias is not defined")
+	}
+}
@@ -0,0 +1,130 @@
+package openai
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+)
+
+// Message metadata keys of the audio generated by the model.
+const (
+	audioIDKey        = "audioId"
+	audioExpiresAtKey = "audioExpiresAt"
+)
+
+// AudioConfig is the configuration of the audio generated by the model.
+// See https://platform.openai.com/docs/guides/audio
+type AudioConfig struct {
+	// Voice is the voice used by the model, e.g. "alloy", "echo" or "shimmer".
+	Voice string `json:"voice"`
+	// Format is the audio format: "wav", "mp3", "flac", "opus" or "pcm16".
+	// Streaming requires "pcm16".
+	Format string `json:"format"`
+}
+
+// audioContentTypes maps the audio output formats to their MIME types.
+var audioContentTypes = map[string]string{
+	"wav":   "audio/wav",
+	"mp3":   "audio/mpeg",
+	"flac":  "audio/flac",
+	"opus":  "audio/opus",
+	"pcm16": "audio/pcm",
+}
+
+// audioOutput is the audio generated by the model, which is not supported by [goopenai] yet.
+type audioOutput struct {
+	ID string `json:"id"`
+	// Data is the base64 encoded audio.
+	Data       string `json:"data"`
+	ExpiresAt  int64  `json:"expires_at"`
+	Transcript string `json:"transcript"`
+}
+
+// messageAudio returns the audio of the message, or nil if there is none.
+func messageAudio(message goopenai.ChatCompletionMessage) *audioOutput {
+	return parseAudio(message.JSON.ExtraFields["audio"].Raw())
+}
+
+// deltaAudio returns the audio fragment of the streamed delta, or nil if there is none.
+func deltaAudio(delta goopenai.ChatCompletionChunkChoicesDelta) *audioOutput {
+	return parseAudio(delta.JSON.ExtraFields["audio"].Raw())
+}
+
+func parseAudio(raw string) *audioOutput {
+	if raw == "" || raw == "null" {
+		return nil
+	}
+	var audio audioOutput
+	if err := json.Unmarshal([]byte(raw), &audio); err != nil {
+		return nil
+	}
+	return &audio
+}
+
+// audioPart returns a media part holding the base64 encoded audio in the given output format,
+// or nil if the format is not known, since the audio cannot be decoded without it.
+func audioPart(data, format string) *ai.Part {
+	if format == "" {
+		return nil
+	}
+	contentType, ok := audioContentTypes[format]
+	if !ok {
+		contentType = "audio/" + format
+	}
+	return ai.NewMediaPart(contentType, "data:"+contentType+";base64,"+data)
+}
+
+// translateAudio sets the audio generated by the model and its transcript as the content of the message.
+// The audio ID is kept in the metadata, so that the audio can be referred to in later turns.
+func translateAudio(m *ai.Message, audio *audioOutput, format string) {
+	m.Content = nil
+	if part := audioPart(audio.Data, format); part != nil {
+		m.Content = append(m.Content, part)
+	}
+	m.Content = append(m.Content, ai.NewTextPart(audio.Transcript))
+	if m.Metadata == nil {
+		m.Metadata = map[string]any{}
+	}
+	m.Metadata[audioIDKey] = audio.ID
+	m.Metadata[audioExpiresAtKey] = audio.ExpiresAt
+}
+
+// assistantAudioMessageParam is an assistant message referring to audio generated by the model,
+// which is not supported by goopenai yet.
+type assistantAudioMessageParam struct {
+	goopenai.ChatCompletionAssistantMessageParam
+	// AudioID is the ID of the audio.
+	AudioID string
+}
+
+func (r assistantAudioMessageParam) MarshalJSON() ([]byte, error) {
+	b, err := r.ChatCompletionAssistantMessageParam.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	fields["audio"] = map[string]any{"id": r.AudioID}
+	return json.Marshal(fields)
+}
+
+// audioID returns the ID of the audio recorded by [translateAudio] in the message metadata.
+// It returns an empty string if the message has no audio or the audio has expired on the server.
+func audioID(m *ai.Message) string {
+	id, _ := m.Metadata[audioIDKey].(string)
+	var expiresAt int64
+	switch v := m.Metadata[audioExpiresAtKey].(type) {
+	case int64:
+		expiresAt = v
+	case float64: // e.g. the message was unmarshaled from JSON
+		expiresAt = int64(v)
+	}
+	if expiresAt > 0 && time.Now().Unix() >= expiresAt {
+		return ""
+	}
+	return id
+}
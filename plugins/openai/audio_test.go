@@ -0,0 +1,308 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+func TestTranslateCandidateAudio(t *testing.T) {
+	var choice goopenai.ChatCompletionChoice
+	err := json.Unmarshal([]byte(`{
+		"index": 0,
+		"message": {
+			"role": "assistant",
+			"content": null,
+			"refusal": null,
+			"audio": {
+				"id": "audio_abc",
+				"data": "UklGRg==",
+				"expires_at": 1729018505,
+				"transcript": "Hello there!"
+			}
+		},
+		"logprobs": null,
+		"finish_reason": "stop"
+	}`), &choice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := translateCandidate(choice, translateOptions{audioFormat: "wav"})
+	want := &ai.Candidate{
+		Index:        0,
+		FinishReason: ai.FinishReasonStop,
+		Message: &ai.Message{
+			Role: ai.RoleModel,
+			Content: []*ai.Part{
+				ai.NewMediaPart("audio/wav", "data:audio/wav;base64,UklGRg=="),
+				ai.NewTextPart("Hello there!"),
+			},
+			Metadata: map[string]any{
+				audioIDKey:        "audio_abc",
+				audioExpiresAtKey: int64(1729018505),
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("translateCandidate() = %#v, want %#v", got, want)
+	}
+}
+
+func TestConvertMessagesAudio(t *testing.T) {
+	user := &ai.Message{
+		Role:    ai.RoleUser,
+		Content: []*ai.Part{ai.NewTextPart("Say hello.")},
+	}
+	audioMessage := func(expiresAt int64) *ai.Message {
+		return &ai.Message{
+			Role: ai.RoleModel,
+			Content: []*ai.Part{
+				ai.NewMediaPart("audio/wav", "data:audio/wav;base64,UklGRg=="),
+				ai.NewTextPart("Hello there!"),
+			},
+			Metadata: map[string]any{
+				audioIDKey:        "audio_abc",
+				audioExpiresAtKey: expiresAt,
+			},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		input []*ai.Message
+		want  []goopenai.ChatCompletionMessageParamUnion
+	}{
+		{
+			name:  "audio is referred to by ID",
+			input: []*ai.Message{user, audioMessage(time.Now().Add(time.Hour).Unix())},
+			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.UserMessageParts(goopenai.TextPart("Say hello.")),
+				assistantAudioMessageParam{
+					ChatCompletionAssistantMessageParam: goopenai.ChatCompletionAssistantMessageParam{
+						Role: goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
+					},
+					AudioID: "audio_abc",
+				},
+			},
+		},
+		{
+			name:  "expired audio is replaced by its transcript",
+			input: []*ai.Message{user, audioMessage(time.Now().Add(-time.Hour).Unix())},
+			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.UserMessageParts(goopenai.TextPart("Say hello.")),
+				goopenai.AssistantMessage("Hello there!"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertMessages(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertMessages() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertRequestAudioID(t *testing.T) {
+	// The system message is moved by the conversion for reasoning models, which does not affect the audio.
+	req := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			ai.NewSystemTextMessage("Be brief."),
+			ai.NewUserTextMessage("Say hello."),
+			{
+				Role:     ai.RoleModel,
+				Content:  []*ai.Part{ai.NewTextPart("Hello there!")},
+				Metadata: map[string]any{audioIDKey: "audio_abc"},
+			},
+		},
+	}
+	info := testModelInfo("gpt-4o-audio-preview")
+	info.Reasoning = true
+	params, _, err := convertRequest("gpt-4o-audio-preview", info, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Messages []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(b, &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"role": "assistant", "audio": map[string]any{"id": "audio_abc"}}
+	if !reflect.DeepEqual(body.Messages[2], want) {
+		t.Errorf("assistant message = %v, want %v", body.Messages[2], want)
+	}
+}
+
+func TestConvertRequestAudioOutput(t *testing.T) {
+	req := &ai.GenerateRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Say hello.")},
+		Config:   &GenerationConfig{Modalities: []string{"text", "audio"}},
+	}
+	if _, _, err := convertRequest("gpt-4o-audio-preview", testModelInfo("gpt-4o-audio-preview"), req, nil); err == nil {
+		t.Error("convertRequest() succeeded without GenerationConfig.Audio, want error")
+	}
+	req.Config = &GenerationConfig{Modalities: []string{"text", "audio"}, Audio: &AudioConfig{Voice: "alloy", Format: "wav"}}
+	if _, _, err := convertRequest("gpt-4o-audio-preview", testModelInfo("gpt-4o-audio-preview"), req, nil); err != nil {
+		t.Errorf("convertRequest() error = %v", err)
+	}
+}
+
+func TestTranslateAudioUnknownFormat(t *testing.T) {
+	m := &ai.Message{Role: ai.RoleModel}
+	translateAudio(m, &audioOutput{ID: "audio_abc", Data: "UklGRg==", Transcript: "Hello there!"}, "")
+	if want := []*ai.Part{ai.NewTextPart("Hello there!")}; !reflect.DeepEqual(m.Content, want) {
+		t.Errorf("content = %#v, want only the transcript", m.Content)
+	}
+}
+
+func TestGenerateStreamAudio(t *testing.T) {
+	client := newStreamingTestClient(t, []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-audio-preview","choices":[{"index":0,"delta":{"role":"assistant","content":null,"audio":{"id":"audio_abc","transcript":"Hello"}},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-audio-preview","choices":[{"index":0,"delta":{"audio":{"data":"AAEC"}},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-audio-preview","choices":[{"index":0,"delta":{"audio":{"data":"Aw=="}},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-audio-preview","choices":[{"index":0,"delta":{"audio":{"expires_at":1729018505,"transcript":"!"}},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-audio-preview","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	})
+
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewTextPart("Say hello.")},
+			},
+		},
+		Config: &GenerationConfig{
+			Modalities: []string{"text", "audio"},
+			Audio:      &AudioConfig{Voice: "alloy", Format: "pcm16"},
+		},
+	}
+
+	var streamed []*ai.Part
+	cb := func(ctx context.Context, chunk *ai.GenerateResponseChunk) error {
+		streamed = append(streamed, chunk.Content...)
+		return nil
+	}
+
+	got, err := (&Plugin{client: client}).generate(context.Background(), "gpt-4o-audio-preview", testModelInfo("gpt-4o-audio-preview"), input, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStreamed := []*ai.Part{
+		ai.NewTextPart("Hello"),
+		ai.NewMediaPart("audio/pcm", "data:audio/pcm;base64,AAEC"),
+		ai.NewMediaPart("audio/pcm", "data:audio/pcm;base64,Aw=="),
+		ai.NewTextPart("!"),
+	}
+	if !reflect.DeepEqual(streamed, wantStreamed) {
+		t.Errorf("streamed parts = %#v, want %#v", streamed, wantStreamed)
+	}
+	if len(got.Candidates) != 1 {
+		t.Fatalf("got %d candidates, want 1", len(got.Candidates))
+	}
+	wantMessage := &ai.Message{
+		Role: ai.RoleModel,
+		Content: []*ai.Part{
+			ai.NewMediaPart("audio/pcm", "data:audio/pcm;base64,AAECAw=="),
+			ai.NewTextPart("Hello!"),
+		},
+		Metadata: map[string]any{
+			audioIDKey:        "audio_abc",
+			audioExpiresAtKey: int64(1729018505),
+		},
+	}
+	if !reflect.DeepEqual(got.Candidates[0].Message, wantMessage) {
+		t.Errorf("candidate message = %#v, want %#v", got.Candidates[0].Message, wantMessage)
+	}
+}
+
+func TestDefineModelAudio(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"created": 1,
+			"model": "gpt-4o-audio-preview",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hello"}}]
+		}`)
+	}))
+	defer srv.Close()
+
+	p := &Plugin{
+		provider: "test-audio",
+		client:   goopenai.NewClient(option.WithAPIKey("test"), option.WithBaseURL(srv.URL)),
+		catalog:  knownModels,
+	}
+	audio := &ai.GenerateRequest{
+		Messages: []*ai.Message{ai.NewUserMessage(ai.NewMediaPart("audio/wav", "data:audio/wav;base64,UklGRg=="))},
+	}
+
+	tests := []struct {
+		name    string
+		define  func() (ai.Model, error)
+		wantErr bool
+	}{
+		{
+			name:   "known audio model",
+			define: func() (ai.Model, error) { return p.DefineModel("gpt-4o-audio-preview", &Audio) },
+		},
+		{
+			name: "audio modality",
+			define: func() (ai.Model, error) {
+				return p.DefineModelInfo("my-audio-deployment", ModelInfo{
+					Supports:         Audio,
+					InputModalities:  []string{ModalityText, ModalityAudio},
+					OutputModalities: []string{ModalityText, ModalityAudio},
+				})
+			},
+		},
+		{
+			// The capabilities do not tell whether the model accepts audio.
+			name:    "unknown model",
+			define:  func() (ai.Model, error) { return p.DefineModel("my-other-deployment", &Audio) },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.define()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = m.Generate(context.Background(), audio, nil)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("Generate() error = %v", err)
+				}
+				return
+			}
+			var capErr *UnsupportedCapabilityError
+			if !errors.As(err, &capErr) {
+				t.Errorf("Generate() error = %v, want an UnsupportedCapabilityError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package openai
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Model types in the catalog.
+const (
+	ModelTypeChat      = "chat"
+	ModelTypeEmbedding = "embedding"
+)
+
+// Response formats in the catalog.
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// Modalities in the catalog.
+const (
+	ModalityText  = "text"
+	ModalityImage = "image"
+	ModalityAudio = "audio"
+)
+
+// ModelInfo describes an OpenAI model in the model catalog.
+type ModelInfo struct {
+	// Type is the type of the model: "chat" or "embedding".
+	Type string `json:"type"`
+	// Supports describes the capabilities of chat models.
+	Supports ai.ModelCapabilities `json:"supports"`
+	// Reasoning is set for reasoning models (o1, o3 and o4 families): system messages are sent as
+	// developer messages, the sampling parameters are dropped, and [GenerationConfig.ReasoningEffort] is supported.
+	Reasoning bool `json:"reasoning,omitempty"`
+	// ContextWindow is the maximum number of tokens of the input and output.
+	ContextWindow int `json:"contextWindow,omitempty"`
+	// MaxOutputTokens is the maximum number of output tokens.
+	MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+	// ResponseFormats are the supported response formats: "text", "json_object" and "json_schema".
+	ResponseFormats []string `json:"responseFormats,omitempty"`
+	// InputModalities are the supported input types: "text", "image" and "audio".
+	InputModalities []string `json:"inputModalities,omitempty"`
+	// OutputModalities are the supported output types: "text" and "audio".
+	OutputModalities []string `json:"outputModalities,omitempty"`
+	// Pricing is the price of the model, if known.
+	Pricing *Pricing `json:"pricing,omitempty"`
+	// Encoding is the tokenizer encoding of the model: "cl100k_base" or "o200k_base".
+	Encoding string `json:"encoding,omitempty"`
+	// DeprecationDate is the date (YYYY-MM-DD) when the model is shut down, if announced.
+	DeprecationDate string `json:"deprecationDate,omitempty"`
+}
+
+// Pricing is the price of a model in USD per 1M tokens.
+type Pricing struct {
+	Input       float64 `json:"input,omitempty"`
+	CachedInput float64 `json:"cachedInput,omitempty"`
+	Output      float64 `json:"output,omitempty"`
+	AudioInput  float64 `json:"audioInput,omitempty"`
+	AudioOutput float64 `json:"audioOutput,omitempty"`
+}
+
+// supportsResponseFormat reports whether the model supports the response format.
+func (m ModelInfo) supportsResponseFormat(format string) bool {
+	return slices.Contains(m.ResponseFormats, format)
+}
+
+// supportsInput reports whether the model accepts the input modality.
+func (m ModelInfo) supportsInput(modality string) bool {
+	return slices.Contains(m.InputModalities, modality)
+}
+
+// embeddedCatalog is the catalog of the models known by the plugin.
+//
+//go:embed models.json
+var embeddedCatalog []byte
+
+// ParseCatalog parses a model catalog in JSON, keyed by model name.
+// See models.json in this package for an example.
+func ParseCatalog(data []byte) (map[string]ModelInfo, error) {
+	var models map[string]ModelInfo
+	if err := json.Unmarshal(data, &models); err != nil {
+		return nil, fmt.Errorf("invalid model catalog: %w", err)
+	}
+	for name, m := range models {
+		if m.Type != ModelTypeChat && m.Type != ModelTypeEmbedding {
+			return nil, fmt.Errorf("invalid model catalog: model %q has unknown type %q", name, m.Type)
+		}
+	}
+	return models, nil
+}
+
+// catalog is the set of known models. It is not modified once created.
+type catalog struct {
+	models map[string]ModelInfo
+}
+
+// knownModels is the embedded catalog. Each plugin has a copy of it, merged with [Config.Catalog].
+var knownModels = func() *catalog {
+	models, err := ParseCatalog(embeddedCatalog)
+	if err != nil {
+		panic(err)
+	}
+	return &catalog{models: models}
+}()
+
+// with returns a copy of the catalog with the models added, replacing the models with the same name.
+func (c *catalog) with(models map[string]ModelInfo) *catalog {
+	m := maps.Clone(c.models)
+	maps.Copy(m, models)
+	return &catalog{models: m}
+}
+
+// lookup returns the model with the given name.
+// Fine-tuned models (e.g. "ft:gpt-4o-mini-2024-07-18:org::id") are described by their base model
+// or, if the base model is a snapshot missing from the catalog (e.g. "gpt-3.5-turbo-0125"), by the model
+// it is a snapshot of. Other snapshots are described by their own entry only, since they may differ
+// from the model they are a snapshot of in capabilities and price.
+func (c *catalog) lookup(name string) (ModelInfo, bool) {
+	if m, ok := c.models[name]; ok {
+		return m, true
+	}
+	base, ok := fineTunedBaseModel(name)
+	if !ok {
+		return ModelInfo{}, false
+	}
+	if m, ok := c.models[base]; ok {
+		return m, true
+	}
+	m, ok := c.models[snapshotRegexp.ReplaceAllString(base, "")]
+	return m, ok
+}
+
+// snapshotRegexp matches the date suffix of a snapshot, e.g. "-2024-07-18" or "-0613".
+var snapshotRegexp = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{4})$`)
+
+// byType returns the names of the models of the given type, sorted.
+func (c *catalog) byType(typ string) []string {
+	var names []string
+	for name, m := range c.models {
+		if m.Type == typ {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// fineTunedBaseModel returns the base model of a fine-tuned model named "ft:<base>:<org>:<suffix>:<id>".
+func fineTunedBaseModel(name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, "ft:")
+	if !ok {
+		return "", false
+	}
+	base, _, _ := strings.Cut(rest, ":")
+	return base, base != ""
+}
+
+// LookupModelInfo returns the description of the model in the catalog of the plugin created by [Init],
+// or in the embedded catalog if Init was not called. It reports false if the model is unknown.
+func LookupModelInfo(name string) (ModelInfo, bool) {
+	if p := defaultPlugin(); p != nil {
+		return p.LookupModelInfo(name)
+	}
+	return knownModels.lookup(name)
+}
+
+// LookupModelInfo returns the description of the model in the catalog of the plugin,
+// the embedded catalog merged with [Config.Catalog]. It reports false if the model is unknown.
+func (p *Plugin) LookupModelInfo(name string) (ModelInfo, bool) {
+	return p.models().lookup(name)
+}
+
+// models returns the catalog of the plugin.
+// A plugin without a catalog, as in tests, uses the embedded catalog.
+func (p *Plugin) models() *catalog {
+	if p.catalog == nil {
+		return knownModels
+	}
+	return p.catalog
+}
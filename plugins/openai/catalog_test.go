@@ -0,0 +1,142 @@
+package openai
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestParseCatalog(t *testing.T) {
+	got, err := ParseCatalog([]byte(`{
+		"my-model": {
+			"type": "chat",
+			"supports": {"multiturn": true, "media": false, "tools": true, "systemRole": true},
+			"contextWindow": 32768,
+			"responseFormats": ["text", "json_object"],
+			"inputModalities": ["text"],
+			"pricing": {"input": 1, "output": 2},
+			"deprecationDate": "2025-06-30"
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ModelInfo{
+		"my-model": {
+			Type:            ModelTypeChat,
+			Supports:        BasicText,
+			ContextWindow:   32768,
+			ResponseFormats: []string{ResponseFormatText, ResponseFormatJSONObject},
+			InputModalities: []string{ModalityText},
+			Pricing:         &Pricing{Input: 1, Output: 2},
+			DeprecationDate: "2025-06-30",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCatalog() = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseCatalogError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "invalid JSON",
+			input: `{"my-model": `,
+		},
+		{
+			name:  "unknown type",
+			input: `{"my-model": {"type": "image"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCatalog([]byte(tt.input)); err == nil {
+				t.Error("ParseCatalog() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestCatalogLookup(t *testing.T) {
+	base := &catalog{models: map[string]ModelInfo{
+		"gpt-4o-mini": {Type: ModelTypeChat, Supports: Multimodal},
+	}}
+	c := base.with(map[string]ModelInfo{
+		"my-model": {Type: ModelTypeChat, Supports: BasicText},
+	})
+	if _, ok := base.lookup("my-model"); ok {
+		t.Error("with() modified the original catalog")
+	}
+
+	tests := []struct {
+		name   string
+		want   ai.ModelCapabilities
+		wantOK bool
+	}{
+		{name: "gpt-4o-mini", want: Multimodal, wantOK: true},
+		{name: "my-model", want: BasicText, wantOK: true},
+		{name: "ft:gpt-4o-mini:acme::xyz", want: Multimodal, wantOK: true},
+		{name: "ft:gpt-4o-mini-2024-07-18:acme::xyz", want: Multimodal, wantOK: true},
+		{name: "ft:my-model-0613:acme::xyz", want: BasicText, wantOK: true},
+		{name: "gpt-4o-mini-2025-01-01", wantOK: false},
+		{name: "my-model-2024-01-01", wantOK: false},
+		{name: "ft:unknown:acme::xyz", wantOK: false},
+		{name: "unknown", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := c.lookup(tt.name)
+			if ok != tt.wantOK {
+				t.Fatalf("lookup(%q) ok = %v, want %v", tt.name, ok, tt.wantOK)
+			}
+			if got.Supports != tt.want {
+				t.Errorf("lookup(%q) = %#v, want %#v", tt.name, got.Supports, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedCatalog(t *testing.T) {
+	for _, name := range knownModels.byType(ModelTypeChat) {
+		m, _ := knownModels.lookup(name)
+		if !m.Supports.Multiturn {
+			t.Errorf("chat model %q does not support multiturn", name)
+		}
+		if m.ContextWindow == 0 || m.MaxOutputTokens == 0 {
+			t.Errorf("chat model %q has no token limits", name)
+		}
+	}
+	// Snapshots that differ from their base model have their own description.
+	if m, ok := knownModels.lookup("gpt-4o-2024-05-13"); !ok || m.supportsResponseFormat(ResponseFormatJSONSchema) || m.Pricing == nil || *m.Pricing != (Pricing{Input: 5, Output: 15}) {
+		t.Errorf("gpt-4o-2024-05-13 = %+v, want no json_schema and a price of $5/$15", m)
+	}
+	for _, name := range []string{"o1", "o1-mini", "o3-mini", "o4-mini"} {
+		if m, ok := knownModels.lookup(name); !ok || !m.Reasoning {
+			t.Errorf("%s = %+v, want a reasoning model", name, m)
+		}
+	}
+	// o1-mini accepts neither system nor developer messages.
+	if m, _ := knownModels.lookup("o1-mini"); m.Supports.SystemRole {
+		t.Errorf("o1-mini supports the system role")
+	}
+	// The audio models do not accept images.
+	for _, name := range []string{"gpt-4o-audio-preview", "gpt-4o-audio-preview-2024-10-01"} {
+		if m, ok := knownModels.lookup(name); !ok || m.Supports.Media || !m.supportsInput(ModalityAudio) || m.supportsInput(ModalityImage) {
+			t.Errorf("%s = %+v, want audio input and no image input", name, m)
+		}
+	}
+	if got := knownModels.byType(ModelTypeEmbedding); len(got) == 0 {
+		t.Error("no embedders in the catalog")
+	}
+	for name, m := range knownModels.models {
+		if m.Encoding == "" {
+			t.Errorf("model %q has no encoding", name)
+		}
+	}
+}
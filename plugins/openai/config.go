@@ -0,0 +1,85 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// GenerationConfig is the configuration for generation with OpenAI models.
+// It can be used instead of [ai.GenerationCommonConfig] to set options only supported by OpenAI.
+// The number of choices to generate is set with [ai.GenerateRequest.Candidates].
+// The sampling parameters (e.g. Temperature, TopP, the penalties and Logprobs) are ignored by reasoning models.
+type GenerationConfig struct {
+	ai.GenerationCommonConfig
+	// Seed makes a best effort to sample deterministically if set.
+	Seed *int64 `json:"seed,omitempty"`
+	// PresencePenalty penalizes new tokens based on whether they appear in the text so far (-2.0 to 2.0).
+	PresencePenalty float64 `json:"presencePenalty,omitempty"`
+	// FrequencyPenalty penalizes new tokens based on their frequency in the text so far (-2.0 to 2.0).
+	FrequencyPenalty float64 `json:"frequencyPenalty,omitempty"`
+	// LogitBias modifies the likelihood of the specified tokens, keyed by token ID (-100 to 100).
+	LogitBias map[string]int64 `json:"logitBias,omitempty"`
+	// ReasoningEffort constrains the effort on reasoning of reasoning models: "low", "medium" or "high".
+	// Lower effort results in faster responses and fewer reasoning tokens.
+	// It is ignored by other models.
+	ReasoningEffort string `json:"reasoningEffort,omitempty"`
+	// Logprobs returns the log probabilities of the output tokens in [CandidateCustom] if set.
+	Logprobs bool `json:"logprobs,omitempty"`
+	// TopLogprobs is the number of most likely alternatives (0 to 20) to return for each output token.
+	// It implies Logprobs.
+	TopLogprobs int64 `json:"topLogprobs,omitempty"`
+	// Modalities are the output types generated by the model: ["text"] by default, or ["text", "audio"]
+	// to generate speech with models supporting audio output, in which case Audio is required.
+	Modalities []string `json:"modalities,omitempty"`
+	// Audio is the configuration of the audio output.
+	Audio *AudioConfig `json:"audio,omitempty"`
+	// User is a unique identifier of the end-user, used to monitor and detect abuse.
+	User string `json:"user,omitempty"`
+	// ToolChoice controls which tool is called by the model:
+	// "none", "auto", "required" or the name of a tool to force the model to call it.
+	ToolChoice string `json:"toolChoice,omitempty"`
+	// ParallelToolCalls enables or disables parallel function calling during tool use if set.
+	ParallelToolCalls *bool `json:"parallelToolCalls,omitempty"`
+	// ServiceTier is the latency tier to use for processing the request, e.g. "auto" or "default".
+	ServiceTier string `json:"serviceTier,omitempty"`
+	// Store stores the output of the request for use in model distillation or evals if set.
+	Store *bool `json:"store,omitempty"`
+}
+
+// generationConfig returns the [GenerationConfig] of a request.
+// The config may be given as [GenerationConfig], [ai.GenerationCommonConfig],
+// or as a map when the request was unmarshaled from JSON (e.g. from the Genkit Developer UI).
+func generationConfig(config any) (*GenerationConfig, error) {
+	switch c := config.(type) {
+	case nil:
+		return &GenerationConfig{}, nil
+	case *GenerationConfig:
+		if c == nil {
+			return &GenerationConfig{}, nil
+		}
+		return c, nil
+	case GenerationConfig:
+		return &c, nil
+	case *ai.GenerationCommonConfig:
+		if c == nil {
+			return &GenerationConfig{}, nil
+		}
+		return &GenerationConfig{GenerationCommonConfig: *c}, nil
+	case ai.GenerationCommonConfig:
+		return &GenerationConfig{GenerationCommonConfig: c}, nil
+	case map[string]any:
+		b, err := json.Marshal(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid generation config: %w", err)
+		}
+		var gc GenerationConfig
+		if err := json.Unmarshal(b, &gc); err != nil {
+			return nil, fmt.Errorf("invalid generation config: %w", err)
+		}
+		return &gc, nil
+	default:
+		return nil, fmt.Errorf("unsupported generation config type %T", config)
+	}
+}
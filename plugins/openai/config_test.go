@@ -0,0 +1,80 @@
+package openai
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestGenerationConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		input any
+		want  *GenerationConfig
+	}{
+		{
+			name:  "nil",
+			input: nil,
+			want:  &GenerationConfig{},
+		},
+		{
+			name:  "common config",
+			input: &ai.GenerationCommonConfig{Temperature: 0.5},
+			want: &GenerationConfig{
+				GenerationCommonConfig: ai.GenerationCommonConfig{Temperature: 0.5},
+			},
+		},
+		{
+			name: "OpenAI config",
+			input: &GenerationConfig{
+				GenerationCommonConfig: ai.GenerationCommonConfig{Temperature: 0.5},
+				Seed:                   ptr[int64](1),
+			},
+			want: &GenerationConfig{
+				GenerationCommonConfig: ai.GenerationCommonConfig{Temperature: 0.5},
+				Seed:                   ptr[int64](1),
+			},
+		},
+		{
+			name: "map from JSON",
+			input: map[string]any{
+				"temperature":     0.5,
+				"maxOutputTokens": 100.0,
+				"seed":            1.0,
+				"toolChoice":      "required",
+			},
+			want: &GenerationConfig{
+				GenerationCommonConfig: ai.GenerationCommonConfig{
+					Temperature:     0.5,
+					MaxOutputTokens: 100,
+				},
+				Seed:       ptr[int64](1),
+				ToolChoice: "required",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generationConfig(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generationConfig() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerationConfigUnsupportedType(t *testing.T) {
+	if _, err := generationConfig("temperature=0.5"); err == nil {
+		t.Error("generationConfig() succeeded, want error")
+	}
+}
+
+// ptr returns a pointer to the given value.
+func ptr[T any](v T) *T {
+	return &v
+}
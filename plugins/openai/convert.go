@@ -9,15 +9,26 @@ import (
 	"github.com/openai/openai-go/shared"
 )
 
-func convertRequest(model string, input *ai.GenerateRequest) (goopenai.ChatCompletionNewParams, error) {
+// convertRequest converts the request into the chat completion parameters of the model, described by info.
+// It also returns the fields of the request body that are not supported by [goopenai.ChatCompletionNewParams],
+// which are set with [option.WithJSONSet].
+func convertRequest(model string, info ModelInfo, input *ai.GenerateRequest, isStrictTool func(name string) bool) (goopenai.ChatCompletionNewParams, map[string]any, error) {
+	if !info.supportsInput(ModalityAudio) && hasAudio(input.Messages) {
+		return goopenai.ChatCompletionNewParams{}, nil, fmt.Errorf("model %q does not support audio input", model)
+	}
 	messages, err := convertMessages(input.Messages)
 	if err != nil {
-		return goopenai.ChatCompletionNewParams{}, err
+		return goopenai.ChatCompletionNewParams{}, nil, err
 	}
 
-	tools, err := convertTools(input.Tools)
+	tools, err := convertTools(input.Tools, isStrictTool)
 	if err != nil {
-		return goopenai.ChatCompletionNewParams{}, err
+		return goopenai.ChatCompletionNewParams{}, nil, err
+	}
+
+	reasoning := info.Reasoning
+	if reasoning {
+		messages = developerMessages(messages)
 	}
 
 	chatCompletionRequest := goopenai.ChatCompletionNewParams{
@@ -33,61 +44,177 @@ func convertRequest(model string, input *ai.GenerateRequest) (goopenai.ChatCompl
 		chatCompletionRequest.Tools = goopenai.F(tools)
 	}
 
-	if c, ok := input.Config.(*ai.GenerationCommonConfig); ok && c != nil {
-		if c.MaxOutputTokens != 0 {
+	c, err := generationConfig(input.Config)
+	if err != nil {
+		return goopenai.ChatCompletionNewParams{}, nil, err
+	}
+	if slices.Contains(c.Modalities, "audio") && (c.Audio == nil || c.Audio.Format == "") {
+		return goopenai.ChatCompletionNewParams{}, nil, fmt.Errorf("the audio modality requires GenerationConfig.Audio with a format")
+	}
+	extraFields := map[string]any{}
+	if c.MaxOutputTokens != 0 {
+		if reasoning {
+			// max_tokens does not include the reasoning tokens, so it is rejected by reasoning models.
+			extraFields["max_completion_tokens"] = c.MaxOutputTokens
+		} else {
 			chatCompletionRequest.MaxTokens = goopenai.F(int64(c.MaxOutputTokens))
 		}
-		if len(c.StopSequences) > 0 {
-			chatCompletionRequest.Stop = goopenai.F[goopenai.ChatCompletionNewParamsStopUnion](goopenai.ChatCompletionNewParamsStopArray(c.StopSequences))
-		}
+	}
+	if len(c.StopSequences) > 0 {
+		chatCompletionRequest.Stop = goopenai.F[goopenai.ChatCompletionNewParamsStopUnion](goopenai.ChatCompletionNewParamsStopArray(c.StopSequences))
+	}
+	if c.Seed != nil {
+		chatCompletionRequest.Seed = goopenai.F(*c.Seed)
+	}
+	// NOTE: The sampling parameters are rejected by reasoning models, so they are dropped.
+	if !reasoning {
 		if c.Temperature != 0 {
 			chatCompletionRequest.Temperature = goopenai.F(c.Temperature)
 		}
 		if c.TopP != 0 {
 			chatCompletionRequest.TopP = goopenai.F(c.TopP)
 		}
+		if c.PresencePenalty != 0 {
+			chatCompletionRequest.PresencePenalty = goopenai.F(c.PresencePenalty)
+		}
+		if c.FrequencyPenalty != 0 {
+			chatCompletionRequest.FrequencyPenalty = goopenai.F(c.FrequencyPenalty)
+		}
+		if len(c.LogitBias) > 0 {
+			chatCompletionRequest.LogitBias = goopenai.F(c.LogitBias)
+		}
+		if c.Logprobs || c.TopLogprobs > 0 {
+			chatCompletionRequest.Logprobs = goopenai.F(true)
+		}
+		if c.TopLogprobs > 0 {
+			chatCompletionRequest.TopLogprobs = goopenai.F(c.TopLogprobs)
+		}
+	}
+	if c.ReasoningEffort != "" && reasoning {
+		extraFields["reasoning_effort"] = c.ReasoningEffort
+	}
+	if c.User != "" {
+		chatCompletionRequest.User = goopenai.F(c.User)
+	}
+	// NOTE: The tool options are rejected by the API when no tools are given.
+	if c.ToolChoice != "" && len(tools) > 0 {
+		chatCompletionRequest.ToolChoice = goopenai.F(convertToolChoice(c.ToolChoice))
+	}
+	if c.ParallelToolCalls != nil && len(tools) > 0 {
+		chatCompletionRequest.ParallelToolCalls = goopenai.F(*c.ParallelToolCalls)
+	}
+	if c.ServiceTier != "" {
+		chatCompletionRequest.ServiceTier = goopenai.F(goopenai.ChatCompletionNewParamsServiceTier(c.ServiceTier))
+	}
+	if c.Store != nil {
+		extraFields["store"] = *c.Store
+	}
+	if len(c.Modalities) > 0 {
+		extraFields["modalities"] = c.Modalities
+	}
+	if c.Audio != nil {
+		extraFields["audio"] = c.Audio
+	}
+	if len(extraFields) == 0 {
+		extraFields = nil
 	}
 
+	// NOTE: The response format is only sent to models supporting JSON mode, since text is the default.
 	if input.Output != nil &&
 		input.Output.Format != "" &&
-		slices.Contains(modelsSupportingResponseFormats, model) {
+		info.supportsResponseFormat(ResponseFormatJSONObject) {
 		switch input.Output.Format {
 		case ai.OutputFormatJSON:
-			chatCompletionRequest.ResponseFormat = goopenai.F[goopenai.ChatCompletionNewParamsResponseFormatUnion](goopenai.ChatCompletionNewParamsResponseFormat{
-				Type: goopenai.F(goopenai.ChatCompletionNewParamsResponseFormatTypeJSONObject),
+			if len(input.Output.Schema) == 0 || !info.supportsResponseFormat(ResponseFormatJSONSchema) {
+				chatCompletionRequest.ResponseFormat = goopenai.F[goopenai.ChatCompletionNewParamsResponseFormatUnion](goopenai.ChatCompletionNewParamsResponseFormat{
+					Type: goopenai.F(goopenai.ChatCompletionNewParamsResponseFormatTypeJSONObject),
+				})
+				break
+			}
+			schema, err := strictSchema(input.Output.Schema, false)
+			if err != nil {
+				return goopenai.ChatCompletionNewParams{}, nil, fmt.Errorf("output schema cannot be used for structured outputs: %w", err)
+			}
+			chatCompletionRequest.ResponseFormat = goopenai.F[goopenai.ChatCompletionNewParamsResponseFormatUnion](shared.ResponseFormatJSONSchemaParam{
+				Type: goopenai.F(shared.ResponseFormatJSONSchemaTypeJSONSchema),
+				JSONSchema: goopenai.F(shared.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   goopenai.F(schemaName(schema)),
+					Schema: goopenai.F(schema),
+					Strict: goopenai.F(true),
+				}),
 			})
 		case ai.OutputFormatText:
 			chatCompletionRequest.ResponseFormat = goopenai.F[goopenai.ChatCompletionNewParamsResponseFormatUnion](goopenai.ChatCompletionNewParamsResponseFormat{
 				Type: goopenai.F(goopenai.ChatCompletionNewParamsResponseFormatTypeText),
 			})
+		case ai.OutputFormatMedia:
+			// Audio output is requested with GenerationConfig.Modalities.
 		default:
-			return goopenai.ChatCompletionNewParams{}, fmt.Errorf("unknown output format in a request: %s", input.Output.Format)
+			return goopenai.ChatCompletionNewParams{}, nil, fmt.Errorf("unknown output format in a request: %s", input.Output.Format)
 		}
 	}
 
-	return chatCompletionRequest, nil
+	return chatCompletionRequest, extraFields, nil
 }
 
+// convertMessages converts the messages of a request.
 func convertMessages(messages []*ai.Message) ([]goopenai.ChatCompletionMessageParamUnion, error) {
 	var msgs []goopenai.ChatCompletionMessageParamUnion
 
-	for _, m := range messages {
+	// pendingToolCallIDs holds the IDs of tool calls that have not been answered yet, keyed by tool name.
+	// ai.ToolResponse has no reference to its ai.ToolRequest, so responses are matched to calls by name in order.
+	pendingToolCallIDs := map[string][]string{}
+	generatedToolCallIDs := 0
+
+	for i, m := range messages {
+		refusal, _ := m.Metadata[refusalKey].(string)
+		if len(m.Content) == 0 && refusal == "" {
+			return nil, fmt.Errorf("message %d (%s) has no content", i, m.Role)
+		}
 		role, err := convertRole(m.Role)
 		if err != nil {
 			return nil, err
 		}
 		switch role {
 		case goopenai.ChatCompletionMessageParamRoleSystem: // system
-			sm := goopenai.SystemMessage(m.Content[0].Text)
+			var content []goopenai.ChatCompletionContentPartTextParam
+			for _, p := range m.Content {
+				if !p.IsText() {
+					return nil, fmt.Errorf("unsupported part type in a system message: %#v", p)
+				}
+				content = append(content, goopenai.TextPart(p.Text))
+			}
+			sm := goopenai.ChatCompletionSystemMessageParam{
+				Role:    goopenai.F(goopenai.ChatCompletionSystemMessageParamRoleSystem),
+				Content: goopenai.F(content),
+			}
 			msgs = append(msgs, sm)
 		case goopenai.ChatCompletionMessageParamRoleUser: // user
 			var multiContent []goopenai.ChatCompletionContentPartUnionParam
+			// rawContent holds all the parts including audio, which is not supported by goopenai.
+			var rawContent []any
 			for _, p := range m.Content {
+				if isAudio(p) {
+					part, err := convertAudio(p)
+					if err != nil {
+						return nil, err
+					}
+					rawContent = append(rawContent, part)
+					continue
+				}
 				part, err := convertPart(p)
 				if err != nil {
 					return nil, err
 				}
 				multiContent = append(multiContent, part)
+				rawContent = append(rawContent, part)
+			}
+			if len(rawContent) > len(multiContent) {
+				msgs = append(msgs, goopenai.ChatCompletionUserMessageParam{
+					Role:    goopenai.F(goopenai.ChatCompletionUserMessageParamRoleUser),
+					Content: goopenai.Raw[[]goopenai.ChatCompletionContentPartUnionParam](rawContent),
+				})
+				break
 			}
 			um := goopenai.UserMessageParts(multiContent...)
 			msgs = append(msgs, um)
@@ -95,26 +222,75 @@ func convertMessages(messages []*ai.Message) ([]goopenai.ChatCompletionMessagePa
 			am := goopenai.ChatCompletionAssistantMessageParam{
 				Role: goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
 			}
-			if m.Content[0].Text != "" {
-				am.Content = goopenai.F([]goopenai.ChatCompletionAssistantMessageParamContentUnion{
-					goopenai.TextPart(m.Content[0].Text),
-				})
+			ids := toolCallIDs(m)
+			// Audio generated by the model is referred to by its ID, which replaces the audio and its transcript.
+			audioID := audioID(m)
+			var content []goopenai.ChatCompletionAssistantMessageParamContentUnion
+			var toolCalls []goopenai.ChatCompletionMessageToolCallParam
+			for _, p := range m.Content {
+				switch {
+				case isAudio(p):
+					// The audio cannot be sent back, so only its transcript is sent once the audio has expired.
+					continue
+				case audioID != "" && p.IsText():
+					continue
+				case refusal != "" && p.IsText():
+					// The text of a refusal is sent as the refusal.
+					continue
+				case p.IsText(), p.IsData():
+					// Data parts hold the JSON text generated in JSON mode.
+					if p.Text != "" {
+						content = append(content, goopenai.TextPart(p.Text))
+					}
+					continue
+				case !p.IsToolRequest():
+					return nil, fmt.Errorf("unsupported part type in an assistant message: %#v", p)
+				}
+				var id string
+				if len(toolCalls) < len(ids) && ids[len(toolCalls)] != "" {
+					id = ids[len(toolCalls)]
+				} else {
+					// The message was not returned by this plugin (e.g. a history built by hand), so generate a unique ID.
+					generatedToolCallIDs++
+					id = fmt.Sprintf("call_%d", generatedToolCallIDs)
+				}
+				pendingToolCallIDs[p.ToolRequest.Name] = append(pendingToolCallIDs[p.ToolRequest.Name], id)
+				toolCall, err := convertToolCall(p, id)
+				if err != nil {
+					return nil, err
+				}
+				toolCalls = append(toolCalls, toolCall)
+			}
+			if len(content) > 0 {
+				am.Content = goopenai.F(content)
+			}
+			if refusal != "" {
+				am.Refusal = goopenai.F(refusal)
 			}
-			toolCalls := convertToolCalls(m.Content)
 			if len(toolCalls) > 0 {
 				am.ToolCalls = goopenai.F(toolCalls)
 			}
+			if audioID != "" {
+				msgs = append(msgs, assistantAudioMessageParam{ChatCompletionAssistantMessageParam: am, AudioID: audioID})
+				break
+			}
 			msgs = append(msgs, am)
 		case goopenai.ChatCompletionMessageParamRoleTool: // tool
 			for _, p := range m.Content {
 				if !p.IsToolResponse() {
 					continue
 				}
-				tm := goopenai.ToolMessage(
-					// NOTE: Temporarily set its name instead of its ref (i.e. call_xxxxx) since it's not defined in the ai.ToolResponse struct.
-					p.ToolResponse.Name,
-					mapToJSONString(p.ToolResponse.Output),
-				)
+				name := p.ToolResponse.Name
+				ids := pendingToolCallIDs[name]
+				if len(ids) == 0 {
+					return nil, fmt.Errorf("tool response %q does not match any preceding tool request", name)
+				}
+				pendingToolCallIDs[name] = ids[1:]
+				output, err := toJSONString(p.ToolResponse.Output)
+				if err != nil {
+					return nil, fmt.Errorf("tool %q: invalid output: %w", name, err)
+				}
+				tm := goopenai.ToolMessage(ids[0], output)
 				msgs = append(msgs, tm)
 			}
 		default:
@@ -125,35 +301,30 @@ func convertMessages(messages []*ai.Message) ([]goopenai.ChatCompletionMessagePa
 	return msgs, nil
 }
 
+// hasAudio reports whether any of the user messages holds audio.
+func hasAudio(messages []*ai.Message) bool {
+	for _, m := range messages {
+		if m.Role == ai.RoleUser && slices.ContainsFunc(m.Content, isAudio) {
+			return true
+		}
+	}
+	return false
+}
+
 func convertPart(part *ai.Part) (goopenai.ChatCompletionContentPartUnionParam, error) {
 	switch {
 	case part.IsText():
 		return goopenai.TextPart(part.Text), nil
 	case part.IsMedia():
-		mediaPart := goopenai.ImagePart(part.Text)
-		mediaPart.ImageURL.Value.Detail = goopenai.F(goopenai.ChatCompletionContentPartImageImageURLDetailAuto)
-		return mediaPart, nil
+		return convertMedia(part)
 	default:
 		return nil, fmt.Errorf("unknown part type in a request: %#v", part)
 	}
 }
 
-func convertToolCalls(content []*ai.Part) []goopenai.ChatCompletionMessageToolCallParam {
-	var toolCalls []goopenai.ChatCompletionMessageToolCallParam
-	for _, p := range content {
-		if !p.IsToolRequest() {
-			continue
-		}
-		toolCall := convertToolCall(p)
-		toolCalls = append(toolCalls, toolCall)
-	}
-	return toolCalls
-}
-
-func convertToolCall(part *ai.Part) goopenai.ChatCompletionMessageToolCallParam {
+func convertToolCall(part *ai.Part, id string) (goopenai.ChatCompletionMessageToolCallParam, error) {
 	param := goopenai.ChatCompletionMessageToolCallParam{
-		// NOTE: Temporarily set its name instead of its ref (i.e. call_xxxxx) since it's not defined in the ai.ToolRequest struct.
-		ID:   goopenai.F(part.ToolRequest.Name),
+		ID:   goopenai.F(id),
 		Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
 		Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
 			Name: goopenai.F(part.ToolRequest.Name),
@@ -161,16 +332,39 @@ func convertToolCall(part *ai.Part) goopenai.ChatCompletionMessageToolCallParam
 	}
 
 	if len(part.ToolRequest.Input) > 0 {
-		param.Function.Value.Arguments = goopenai.F(mapToJSONString(part.ToolRequest.Input))
+		arguments, err := toJSONString(part.ToolRequest.Input)
+		if err != nil {
+			return goopenai.ChatCompletionMessageToolCallParam{}, fmt.Errorf("tool %q: invalid input: %w", part.ToolRequest.Name, err)
+		}
+		param.Function.Value.Arguments = goopenai.F(arguments)
 	}
 
-	return param
+	return param, nil
 }
 
-func convertTools(inTools []*ai.ToolDefinition) ([]goopenai.ChatCompletionToolParam, error) {
+// toolCallIDs returns the OpenAI tool call IDs recorded by [translateCandidate] in the message metadata.
+// The IDs are in the same order as the tool request parts of the message.
+func toolCallIDs(m *ai.Message) []string {
+	switch v := m.Metadata[toolCallIDsKey].(type) {
+	case []string:
+		return v
+	case []any: // e.g. the message was unmarshaled from JSON
+		ids := make([]string, len(v))
+		for i, id := range v {
+			ids[i], _ = id.(string)
+		}
+		return ids
+	default:
+		return nil
+	}
+}
+
+// convertTools converts the tool definitions, in strict mode for the tools for which isStrictTool reports true.
+// isStrictTool may be nil if no tool is strict.
+func convertTools(inTools []*ai.ToolDefinition, isStrictTool func(name string) bool) ([]goopenai.ChatCompletionToolParam, error) {
 	var tools []goopenai.ChatCompletionToolParam
 	for _, t := range inTools {
-		tool, err := convertTool(t)
+		tool, err := convertTool(t, isStrictTool != nil && isStrictTool(t.Name))
 		if err != nil {
 			return nil, err
 		}
@@ -179,18 +373,42 @@ func convertTools(inTools []*ai.ToolDefinition) ([]goopenai.ChatCompletionToolPa
 	return tools, nil
 }
 
-func convertTool(t *ai.ToolDefinition) (goopenai.ChatCompletionToolParam, error) {
+func convertTool(t *ai.ToolDefinition, strict bool) (goopenai.ChatCompletionToolParam, error) {
+	params := t.InputSchema
+	if strict {
+		var err error
+		params, err = strictSchema(t.InputSchema, true)
+		if err != nil {
+			return goopenai.ChatCompletionToolParam{}, fmt.Errorf("tool %q cannot be used in strict mode: %w", t.Name, err)
+		}
+	}
 	return goopenai.ChatCompletionToolParam{
 		Type: goopenai.F(goopenai.ChatCompletionToolTypeFunction),
 		Function: goopenai.F(shared.FunctionDefinitionParam{
 			Name:        goopenai.F(t.Name),
 			Description: goopenai.F(t.Description),
-			Parameters:  goopenai.F(goopenai.FunctionParameters(t.InputSchema)),
-			Strict:      goopenai.F(false),
+			Parameters:  goopenai.F(goopenai.FunctionParameters(params)),
+			Strict:      goopenai.F(strict),
 		}),
 	}, nil
 }
 
+func convertToolChoice(toolChoice string) goopenai.ChatCompletionToolChoiceOptionUnionParam {
+	switch choice := goopenai.ChatCompletionToolChoiceOptionString(toolChoice); choice {
+	case goopenai.ChatCompletionToolChoiceOptionStringNone,
+		goopenai.ChatCompletionToolChoiceOptionStringAuto,
+		goopenai.ChatCompletionToolChoiceOptionStringRequired:
+		return choice
+	default: // the name of a tool
+		return goopenai.ChatCompletionNamedToolChoiceParam{
+			Type: goopenai.F(goopenai.ChatCompletionNamedToolChoiceTypeFunction),
+			Function: goopenai.F(goopenai.ChatCompletionNamedToolChoiceFunctionParam{
+				Name: goopenai.F(toolChoice),
+			}),
+		}
+	}
+}
+
 func convertRole(aiRole ai.Role) (goopenai.ChatCompletionMessageParamRole, error) {
 	switch aiRole {
 	case ai.RoleUser: // user -> user
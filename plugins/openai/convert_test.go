@@ -9,6 +9,12 @@ import (
 	"github.com/openai/openai-go/shared"
 )
 
+// testModelInfo returns the description of the model in the embedded catalog, if any.
+func testModelInfo(model string) ModelInfo {
+	info, _ := knownModels.lookup(model)
+	return info
+}
+
 func TestConvertRole(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -75,6 +81,61 @@ func TestConvertPart(t *testing.T) {
 				}),
 			},
 		},
+		{
+			name:  "media part with detail",
+			input: NewImagePart("image/jpeg", "https://example.com/image.jpg", ImageDetailHigh),
+			want: goopenai.ChatCompletionContentPartImageParam{
+				Type: goopenai.F(goopenai.ChatCompletionContentPartImageTypeImageURL),
+				ImageURL: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLParam{
+					URL:    goopenai.F("https://example.com/image.jpg"),
+					Detail: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLDetailHigh),
+				}),
+			},
+		},
+		{
+			name:  "data URL",
+			input: ai.NewMediaPart("image/png; detail=low", "data:image/png;base64,iVBORw0KGgo="),
+			want: goopenai.ChatCompletionContentPartImageParam{
+				Type: goopenai.F(goopenai.ChatCompletionContentPartImageTypeImageURL),
+				ImageURL: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLParam{
+					URL:    goopenai.F("data:image/png;base64,iVBORw0KGgo="),
+					Detail: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLDetailLow),
+				}),
+			},
+		},
+		{
+			name:  "data URL without content type",
+			input: ai.NewMediaPart("", "data:image/gif;base64,R0lGODlh"),
+			want: goopenai.ChatCompletionContentPartImageParam{
+				Type: goopenai.F(goopenai.ChatCompletionContentPartImageTypeImageURL),
+				ImageURL: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLParam{
+					URL:    goopenai.F("data:image/gif;base64,R0lGODlh"),
+					Detail: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLDetailAuto),
+				}),
+			},
+		},
+		{
+			name:  "base64 encoded image",
+			input: ai.NewMediaPart("image/png", "iVBORw0KGgo="),
+			want: goopenai.ChatCompletionContentPartImageParam{
+				Type: goopenai.F(goopenai.ChatCompletionContentPartImageTypeImageURL),
+				ImageURL: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLParam{
+					URL:    goopenai.F("data:image/png;base64,iVBORw0KGgo="),
+					Detail: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLDetailAuto),
+				}),
+			},
+		},
+		{
+			name:  "raw image bytes",
+			input: ai.NewMediaPart("image/png", "\x89PNG\r\n\x1a\n"),
+			want: goopenai.ChatCompletionContentPartImageParam{
+				Type: goopenai.F(goopenai.ChatCompletionContentPartImageTypeImageURL),
+				ImageURL: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLParam{
+					URL:    goopenai.F("data:image/png;base64,iVBORw0KGgo="),
+					Detail: goopenai.F(goopenai.ChatCompletionContentPartImageImageURLDetailAuto),
+				}),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -90,6 +151,46 @@ func TestConvertPart(t *testing.T) {
 	}
 }
 
+func TestConvertPartError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ai.Part
+	}{
+		{
+			name:  "unsupported media type",
+			input: ai.NewMediaPart("application/pdf", "https://example.com/document.pdf"),
+		},
+		{
+			name:  "unsupported data URL type",
+			input: ai.NewMediaPart("", "data:text/html,%3Ch1%3EHi%3C%2Fh1%3E"),
+		},
+		{
+			name:  "content type mismatch",
+			input: ai.NewMediaPart("image/jpeg", "data:image/png;base64,iVBORw0KGgo="),
+		},
+		{
+			name:  "inline media without content type",
+			input: ai.NewMediaPart("", "iVBORw0KGgo="),
+		},
+		{
+			name:  "audio is not an image",
+			input: ai.NewMediaPart("audio/mpeg", "SUQz"),
+		},
+		{
+			name:  "unsupported image detail",
+			input: NewImagePart("image/jpeg", "https://example.com/image.jpg", "ultra"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := convertPart(tt.input); err == nil {
+				t.Error("convertPart() succeeded, want error")
+			}
+		})
+	}
+}
+
 func TestConvertMessages(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -116,7 +217,7 @@ func TestConvertMessages(t *testing.T) {
 					Role: goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
 					ToolCalls: goopenai.F([]goopenai.ChatCompletionMessageToolCallParam{
 						{
-							ID:   goopenai.F("tellAFunnyJoke"),
+							ID:   goopenai.F("call_1"),
 							Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
 							Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
 								Name:      goopenai.F("tellAFunnyJoke"),
@@ -130,6 +231,17 @@ func TestConvertMessages(t *testing.T) {
 		{
 			name: "tool response",
 			input: []*ai.Message{
+				{
+					Role: ai.RoleModel,
+					Content: []*ai.Part{ai.NewToolRequestPart(
+						&ai.ToolRequest{
+							Name: "tellAFunnyJoke",
+						},
+					)},
+					Metadata: map[string]any{
+						"toolCallIds": []string{"call_abc"},
+					},
+				},
 				{
 					Role: ai.RoleTool,
 					Content: []*ai.Part{ai.NewToolResponsePart(
@@ -143,6 +255,18 @@ func TestConvertMessages(t *testing.T) {
 				},
 			},
 			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.ChatCompletionAssistantMessageParam{
+					Role: goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
+					ToolCalls: goopenai.F([]goopenai.ChatCompletionMessageToolCallParam{
+						{
+							ID:   goopenai.F("call_abc"),
+							Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
+							Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
+								Name: goopenai.F("tellAFunnyJoke"),
+							}),
+						},
+					}),
+				},
 				goopenai.ChatCompletionToolMessageParam{
 					Role: goopenai.F(goopenai.ChatCompletionToolMessageParamRoleTool),
 					Content: goopenai.F([]goopenai.ChatCompletionContentPartTextParam{
@@ -151,8 +275,52 @@ func TestConvertMessages(t *testing.T) {
 							Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
 						},
 					}),
-					ToolCallID: goopenai.F("tellAFunnyJoke"),
+					ToolCallID: goopenai.F("call_abc"),
+				},
+			},
+		},
+		{
+			name: "parallel tool calls to the same tool",
+			input: []*ai.Message{
+				{
+					Role: ai.RoleModel,
+					Content: []*ai.Part{
+						ai.NewToolRequestPart(&ai.ToolRequest{Name: "getWeather", Input: map[string]any{"city": "Tokyo"}}),
+						ai.NewToolRequestPart(&ai.ToolRequest{Name: "getWeather", Input: map[string]any{"city": "Paris"}}),
+					},
+				},
+				{
+					Role: ai.RoleTool,
+					Content: []*ai.Part{
+						ai.NewToolResponsePart(&ai.ToolResponse{Name: "getWeather", Output: map[string]any{"weather": "sunny"}}),
+						ai.NewToolResponsePart(&ai.ToolResponse{Name: "getWeather", Output: map[string]any{"weather": "rainy"}}),
+					},
+				},
+			},
+			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.ChatCompletionAssistantMessageParam{
+					Role: goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
+					ToolCalls: goopenai.F([]goopenai.ChatCompletionMessageToolCallParam{
+						{
+							ID:   goopenai.F("call_1"),
+							Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
+							Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
+								Name:      goopenai.F("getWeather"),
+								Arguments: goopenai.F("{\"city\":\"Tokyo\"}"),
+							}),
+						},
+						{
+							ID:   goopenai.F("call_2"),
+							Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
+							Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
+								Name:      goopenai.F("getWeather"),
+								Arguments: goopenai.F("{\"city\":\"Paris\"}"),
+							}),
+						},
+					}),
 				},
+				goopenai.ToolMessage("call_1", "{\"weather\":\"sunny\"}"),
+				goopenai.ToolMessage("call_2", "{\"weather\":\"rainy\"}"),
 			},
 		},
 		{
@@ -252,6 +420,120 @@ func TestConvertMessages(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "system message with several parts",
+			input: []*ai.Message{
+				{
+					Role: ai.RoleSystem,
+					Content: []*ai.Part{
+						ai.NewTextPart("You are a comedian."),
+						ai.NewTextPart("Keep it short."),
+					},
+				},
+			},
+			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.ChatCompletionSystemMessageParam{
+					Role: goopenai.F(goopenai.ChatCompletionSystemMessageParamRoleSystem),
+					Content: goopenai.F([]goopenai.ChatCompletionContentPartTextParam{
+						{
+							Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+							Text: goopenai.F("You are a comedian."),
+						},
+						{
+							Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+							Text: goopenai.F("Keep it short."),
+						},
+					}),
+				},
+			},
+		},
+		{
+			name: "assistant message with text and tool request",
+			input: []*ai.Message{
+				{
+					Role: ai.RoleModel,
+					Content: []*ai.Part{
+						ai.NewTextPart("Let me think of a joke."),
+						ai.NewToolRequestPart(&ai.ToolRequest{
+							Name:  "tellAFunnyJoke",
+							Input: map[string]any{"topic": "bob"},
+						}),
+						ai.NewTextPart("Here it comes."),
+					},
+				},
+			},
+			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.ChatCompletionAssistantMessageParam{
+					Role: goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
+					Content: goopenai.F([]goopenai.ChatCompletionAssistantMessageParamContentUnion{
+						goopenai.ChatCompletionContentPartTextParam{
+							Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+							Text: goopenai.F("Let me think of a joke."),
+						},
+						goopenai.ChatCompletionContentPartTextParam{
+							Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+							Text: goopenai.F("Here it comes."),
+						},
+					}),
+					ToolCalls: goopenai.F([]goopenai.ChatCompletionMessageToolCallParam{
+						{
+							ID:   goopenai.F("call_1"),
+							Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
+							Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
+								Name:      goopenai.F("tellAFunnyJoke"),
+								Arguments: goopenai.F("{\"topic\":\"bob\"}"),
+							}),
+						},
+					}),
+				},
+			},
+		},
+		{
+			name: "audio",
+			input: []*ai.Message{
+				{
+					Role: ai.RoleUser,
+					Content: []*ai.Part{
+						ai.NewTextPart("Transcribe this voice note."),
+						ai.NewMediaPart("audio/wav", "data:audio/wav;base64,UklGRg=="),
+					},
+				},
+			},
+			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.ChatCompletionUserMessageParam{
+					Role: goopenai.F(goopenai.ChatCompletionUserMessageParamRoleUser),
+					Content: goopenai.Raw[[]goopenai.ChatCompletionContentPartUnionParam]([]any{
+						goopenai.ChatCompletionContentPartTextParam{
+							Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+							Text: goopenai.F("Transcribe this voice note."),
+						},
+						inputAudioContentPart{
+							Type: "input_audio",
+							InputAudio: inputAudio{
+								Data:   "UklGRg==",
+								Format: "wav",
+							},
+						},
+					}),
+				},
+			},
+		},
+		{
+			name: "refusal",
+			input: []*ai.Message{
+				{
+					Role:     ai.RoleModel,
+					Content:  []*ai.Part{ai.NewTextPart("I'm sorry, I cannot assist with that request.")},
+					Metadata: map[string]any{refusalKey: "I'm sorry, I cannot assist with that request."},
+				},
+			},
+			want: []goopenai.ChatCompletionMessageParamUnion{
+				goopenai.ChatCompletionAssistantMessageParam{
+					Role:    goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
+					Refusal: goopenai.F("I'm sorry, I cannot assist with that request."),
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -267,10 +549,161 @@ func TestConvertMessages(t *testing.T) {
 	}
 }
 
+func TestConvertMessagesUnmatchedToolResponse(t *testing.T) {
+	input := []*ai.Message{
+		{
+			Role: ai.RoleTool,
+			Content: []*ai.Part{ai.NewToolResponsePart(
+				&ai.ToolResponse{
+					Name:   "tellAFunnyJoke",
+					Output: map[string]any{"joke": "Why did the bob cross the road?"},
+				},
+			)},
+		},
+	}
+	if _, err := convertMessages(input); err == nil {
+		t.Error("convertMessages() succeeded, want error")
+	}
+}
+
+func TestConvertMessagesError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []*ai.Message
+	}{
+		{
+			name: "empty message",
+			input: []*ai.Message{
+				{Role: ai.RoleUser},
+			},
+		},
+		{
+			name: "empty system message",
+			input: []*ai.Message{
+				{Role: ai.RoleSystem, Content: []*ai.Part{}},
+			},
+		},
+		{
+			name: "tool output cannot be marshaled",
+			input: []*ai.Message{
+				{
+					Role: ai.RoleModel,
+					Content: []*ai.Part{ai.NewToolRequestPart(&ai.ToolRequest{
+						Name: "tellAFunnyJoke",
+					})},
+				},
+				{
+					Role: ai.RoleTool,
+					Content: []*ai.Part{ai.NewToolResponsePart(&ai.ToolResponse{
+						Name:   "tellAFunnyJoke",
+						Output: map[string]any{"response": func() {}},
+					})},
+				},
+			},
+		},
+		{
+			name: "media in a system message",
+			input: []*ai.Message{
+				{
+					Role:    ai.RoleSystem,
+					Content: []*ai.Part{ai.NewMediaPart("image/jpeg", "https://example.com/image.jpg")},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := convertMessages(tt.input); err == nil {
+				t.Error("convertMessages() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestConvertAudio(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   *ai.Part
+		want    inputAudioContentPart
+		wantErr bool
+	}{
+		{
+			name:  "mp3",
+			input: ai.NewMediaPart("audio/mpeg", "SUQz"),
+			want: inputAudioContentPart{
+				Type:       "input_audio",
+				InputAudio: inputAudio{Data: "SUQz", Format: "mp3"},
+			},
+		},
+		{
+			name:    "unsupported format",
+			input:   ai.NewMediaPart("audio/ogg", "T2dnUw=="),
+			wantErr: true,
+		},
+		{
+			name:    "URL",
+			input:   ai.NewMediaPart("audio/wav", "https://example.com/voice.wav"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertAudio(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertAudio() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertAudio() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertRequestUnsupportedAudio(t *testing.T) {
+	req := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewMediaPart("audio/wav", "UklGRg==")},
+			},
+		},
+	}
+	if _, _, err := convertRequest(goopenai.ChatModelGPT4oMini, testModelInfo(goopenai.ChatModelGPT4oMini), req, nil); err == nil {
+		t.Error("convertRequest() succeeded, want error")
+	}
+	if _, _, err := convertRequest("gpt-4o-audio-preview", testModelInfo("gpt-4o-audio-preview"), req, nil); err != nil {
+		t.Errorf("convertRequest() error = %v", err)
+	}
+}
+
+func TestConvertRequestUnsupportedOutputSchema(t *testing.T) {
+	req := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewTextPart("Create dummy labels.")},
+			},
+		},
+		Output: &ai.GenerateRequestOutput{
+			Format: ai.OutputFormatJSON,
+			Schema: map[string]any{
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+		},
+	}
+	if _, _, err := convertRequest(goopenai.ChatModelGPT4oMini, testModelInfo(goopenai.ChatModelGPT4oMini), req, nil); err == nil {
+		t.Error("convertRequest() succeeded, want error")
+	}
+}
+
 func TestConvertToolCall(t *testing.T) {
 	tests := []struct {
 		name  string
 		input *ai.Part
+		id    string
 		want  goopenai.ChatCompletionMessageToolCallParam
 	}{
 		{
@@ -283,8 +716,9 @@ func TestConvertToolCall(t *testing.T) {
 					},
 				},
 			),
+			id: "call_1",
 			want: goopenai.ChatCompletionMessageToolCallParam{
-				ID:   goopenai.F("tellAFunnyJoke"),
+				ID:   goopenai.F("call_1"),
 				Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
 				Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
 					Name:      goopenai.F("tellAFunnyJoke"),
@@ -300,8 +734,9 @@ func TestConvertToolCall(t *testing.T) {
 					Input: map[string]any{},
 				},
 			),
+			id: "call_1",
 			want: goopenai.ChatCompletionMessageToolCallParam{
-				ID:   goopenai.F("tellAFunnyJoke"),
+				ID:   goopenai.F("call_1"),
 				Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
 				Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
 					Name: goopenai.F("tellAFunnyJoke"),
@@ -316,8 +751,9 @@ func TestConvertToolCall(t *testing.T) {
 					Input: nil,
 				},
 			),
+			id: "call_1",
 			want: goopenai.ChatCompletionMessageToolCallParam{
-				ID:   goopenai.F("tellAFunnyJoke"),
+				ID:   goopenai.F("call_1"),
 				Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
 				Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
 					Name: goopenai.F("tellAFunnyJoke"),
@@ -328,7 +764,10 @@ func TestConvertToolCall(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := convertToolCall(tt.input)
+			got, err := convertToolCall(tt.input, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("convertToolCall() = %#v, want %#v", got, tt.want)
 			}
@@ -338,9 +777,10 @@ func TestConvertToolCall(t *testing.T) {
 
 func TestConvertTool(t *testing.T) {
 	tests := []struct {
-		name  string
-		input *ai.ToolDefinition
-		want  goopenai.ChatCompletionToolParam
+		name   string
+		input  *ai.ToolDefinition
+		strict bool
+		want   goopenai.ChatCompletionToolParam
 	}{
 		{
 			name: "text part",
@@ -383,11 +823,65 @@ func TestConvertTool(t *testing.T) {
 				}),
 			},
 		},
+		{
+			name: "strict",
+			input: &ai.ToolDefinition{
+				Name:        "searchRestaurants",
+				Description: "use when want to search restaurants",
+				InputSchema: map[string]any{
+					"$schema": "http://json-schema.org/draft-07/schema#",
+					"$ref":    "#/$defs/Query",
+					"$defs": map[string]any{
+						"Query": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"city":    map[string]any{"type": "string"},
+								"cuisine": map[string]any{"type": "string", "enum": []any{"sushi", "ramen"}},
+								"limit":   map[string]any{"type": "integer", "minimum": 1},
+							},
+							"required":             []any{"city"},
+							"additionalProperties": false,
+						},
+					},
+				},
+			},
+			strict: true,
+			want: goopenai.ChatCompletionToolParam{
+				Type: goopenai.F(goopenai.ChatCompletionToolTypeFunction),
+				Function: goopenai.F(shared.FunctionDefinitionParam{
+					Name:        goopenai.F("searchRestaurants"),
+					Description: goopenai.F("use when want to search restaurants"),
+					Strict:      goopenai.F(true),
+					Parameters: goopenai.F(shared.FunctionParameters{
+						"type": "object",
+						"properties": map[string]any{
+							"city":    map[string]any{"type": "string"},
+							"cuisine": map[string]any{"type": []any{"string", "null"}, "enum": []any{"sushi", "ramen", nil}},
+							"limit":   map[string]any{"type": []any{"integer", "null"}},
+						},
+						"required":             []string{"city", "cuisine", "limit"},
+						"additionalProperties": false,
+						"$defs": map[string]any{
+							"Query": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"city":    map[string]any{"type": "string"},
+									"cuisine": map[string]any{"type": []any{"string", "null"}, "enum": []any{"sushi", "ramen", nil}},
+									"limit":   map[string]any{"type": []any{"integer", "null"}},
+								},
+								"required":             []string{"city", "cuisine", "limit"},
+								"additionalProperties": false,
+							},
+						},
+					}),
+				}),
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := convertTool(tt.input)
+			got, err := convertTool(tt.input, tt.strict)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -405,7 +899,8 @@ func TestConvertRequest(t *testing.T) {
 			model string
 			req   *ai.GenerateRequest
 		}
-		want goopenai.ChatCompletionNewParams
+		want            goopenai.ChatCompletionNewParams
+		wantExtraFields map[string]any
 	}{
 		{
 			name: "request with text messages",
@@ -536,7 +1031,7 @@ func TestConvertRequest(t *testing.T) {
 						Role: goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
 						ToolCalls: goopenai.F([]goopenai.ChatCompletionMessageToolCallParam{
 							{
-								ID:   goopenai.F("tellAFunnyJoke"),
+								ID:   goopenai.F("call_1"),
 								Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
 								Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
 									Name:      goopenai.F("tellAFunnyJoke"),
@@ -553,7 +1048,7 @@ func TestConvertRequest(t *testing.T) {
 								Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
 							},
 						}),
-						ToolCallID: goopenai.F("tellAFunnyJoke"),
+						ToolCallID: goopenai.F("call_1"),
 					},
 				}),
 				Tools: goopenai.F([]goopenai.ChatCompletionToolParam{
@@ -662,7 +1157,7 @@ func TestConvertRequest(t *testing.T) {
 						Role: goopenai.F(goopenai.ChatCompletionAssistantMessageParamRoleAssistant),
 						ToolCalls: goopenai.F([]goopenai.ChatCompletionMessageToolCallParam{
 							{
-								ID:   goopenai.F("tellAFunnyJoke"),
+								ID:   goopenai.F("call_1"),
 								Type: goopenai.F(goopenai.ChatCompletionMessageToolCallTypeFunction),
 								Function: goopenai.F(goopenai.ChatCompletionMessageToolCallFunctionParam{
 									Name:      goopenai.F("tellAFunnyJoke"),
@@ -679,7 +1174,7 @@ func TestConvertRequest(t *testing.T) {
 								Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
 							},
 						}),
-						ToolCallID: goopenai.F("tellAFunnyJoke"),
+						ToolCallID: goopenai.F("call_1"),
 					},
 				}),
 				Tools: goopenai.F([]goopenai.ChatCompletionToolParam{
@@ -710,17 +1205,172 @@ func TestConvertRequest(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "request with structured output: json schema",
+			input: struct {
+				model string
+				req   *ai.GenerateRequest
+			}{
+				model: goopenai.ChatModelGPT4oMini,
+				req: &ai.GenerateRequest{
+					Messages: []*ai.Message{
+						{
+							Role:    ai.RoleUser,
+							Content: []*ai.Part{ai.NewTextPart("Create dummy user data.")},
+						},
+					},
+					Output: &ai.GenerateRequestOutput{
+						Format: ai.OutputFormatJSON,
+						Schema: map[string]any{
+							"$schema": "http://json-schema.org/draft-07/schema#",
+							"type":    "object",
+							"properties": map[string]any{
+								"Name": map[string]any{"type": "string"},
+								"Age":  map[string]any{"type": "integer"},
+							},
+							"required":             []any{"Name", "Age"},
+							"additionalProperties": false,
+						},
+					},
+				},
+			},
+			want: goopenai.ChatCompletionNewParams{
+				Model: goopenai.F(goopenai.ChatModelGPT4oMini),
+				Messages: goopenai.F([]goopenai.ChatCompletionMessageParamUnion{
+					goopenai.ChatCompletionUserMessageParam{
+						Role: goopenai.F(goopenai.ChatCompletionUserMessageParamRoleUser),
+						Content: goopenai.F([]goopenai.ChatCompletionContentPartUnionParam{
+							goopenai.ChatCompletionContentPartTextParam{
+								Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+								Text: goopenai.F("Create dummy user data."),
+							},
+						}),
+					},
+				}),
+				ResponseFormat: goopenai.F[goopenai.ChatCompletionNewParamsResponseFormatUnion](
+					shared.ResponseFormatJSONSchemaParam{
+						Type: goopenai.F(shared.ResponseFormatJSONSchemaTypeJSONSchema),
+						JSONSchema: goopenai.F(shared.ResponseFormatJSONSchemaJSONSchemaParam{
+							Name: goopenai.F("output"),
+							Schema: goopenai.F(map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"Name": map[string]any{"type": "string"},
+									"Age":  map[string]any{"type": "integer"},
+								},
+								"required":             []string{"Age", "Name"},
+								"additionalProperties": false,
+							}),
+							Strict: goopenai.F(true),
+						}),
+					},
+				),
+			},
+		},
+		{
+			name: "request with OpenAI generation config",
+			input: struct {
+				model string
+				req   *ai.GenerateRequest
+			}{
+				model: goopenai.ChatModelGPT4oMini,
+				req: &ai.GenerateRequest{
+					Messages: []*ai.Message{
+						{
+							Role:    ai.RoleUser,
+							Content: []*ai.Part{ai.NewTextPart("Tell a joke about dogs.")},
+						},
+					},
+					Tools: []*ai.ToolDefinition{
+						{
+							Name: "tellAFunnyJoke",
+							InputSchema: map[string]any{
+								"type": "object",
+							},
+						},
+					},
+					Config: &GenerationConfig{
+						GenerationCommonConfig: ai.GenerationCommonConfig{
+							Temperature: 0.7,
+						},
+						Seed:              ptr[int64](42),
+						PresencePenalty:   0.5,
+						FrequencyPenalty:  -0.5,
+						LogitBias:         map[string]int64{"50256": -100},
+						TopLogprobs:       2,
+						User:              "user-1234",
+						ToolChoice:        "tellAFunnyJoke",
+						ParallelToolCalls: ptr(false),
+						ServiceTier:       "auto",
+						Store:             ptr(true),
+						Modalities:        []string{"text", "audio"},
+						Audio:             &AudioConfig{Voice: "alloy", Format: "wav"},
+					},
+				},
+			},
+			want: goopenai.ChatCompletionNewParams{
+				Model: goopenai.F(goopenai.ChatModelGPT4oMini),
+				Messages: goopenai.F([]goopenai.ChatCompletionMessageParamUnion{
+					goopenai.ChatCompletionUserMessageParam{
+						Role: goopenai.F(goopenai.ChatCompletionUserMessageParamRoleUser),
+						Content: goopenai.F([]goopenai.ChatCompletionContentPartUnionParam{
+							goopenai.ChatCompletionContentPartTextParam{
+								Type: goopenai.F(goopenai.ChatCompletionContentPartTextTypeText),
+								Text: goopenai.F("Tell a joke about dogs."),
+							},
+						}),
+					},
+				}),
+				Tools: goopenai.F([]goopenai.ChatCompletionToolParam{
+					{
+						Type: goopenai.F(goopenai.ChatCompletionToolTypeFunction),
+						Function: goopenai.F(shared.FunctionDefinitionParam{
+							Name:        goopenai.F("tellAFunnyJoke"),
+							Description: goopenai.F(""),
+							Parameters: goopenai.F(shared.FunctionParameters{
+								"type": "object",
+							}),
+							Strict: goopenai.F(false),
+						}),
+					},
+				}),
+				Temperature:      goopenai.F(0.7),
+				Seed:             goopenai.F[int64](42),
+				PresencePenalty:  goopenai.F(0.5),
+				FrequencyPenalty: goopenai.F(-0.5),
+				LogitBias:        goopenai.F(map[string]int64{"50256": -100}),
+				Logprobs:         goopenai.F(true),
+				TopLogprobs:      goopenai.F[int64](2),
+				User:             goopenai.F("user-1234"),
+				ToolChoice: goopenai.F[goopenai.ChatCompletionToolChoiceOptionUnionParam](goopenai.ChatCompletionNamedToolChoiceParam{
+					Type: goopenai.F(goopenai.ChatCompletionNamedToolChoiceTypeFunction),
+					Function: goopenai.F(goopenai.ChatCompletionNamedToolChoiceFunctionParam{
+						Name: goopenai.F("tellAFunnyJoke"),
+					}),
+				}),
+				ParallelToolCalls: goopenai.F(false),
+				ServiceTier:       goopenai.F(goopenai.ChatCompletionNewParamsServiceTierAuto),
+			},
+			wantExtraFields: map[string]any{
+				"store":      true,
+				"modalities": []string{"text", "audio"},
+				"audio":      &AudioConfig{Voice: "alloy", Format: "wav"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := convertRequest(tt.input.model, tt.input.req)
+			got, gotExtraFields, err := convertRequest(tt.input.model, testModelInfo(tt.input.model), tt.input.req, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("convertRequest() = %#v, want %#v", got, tt.want)
 			}
+			if !reflect.DeepEqual(gotExtraFields, tt.wantExtraFields) {
+				t.Errorf("convertRequest() extra fields = %#v, want %#v", gotExtraFields, tt.wantExtraFields)
+			}
 		})
 	}
 }
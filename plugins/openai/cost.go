@@ -0,0 +1,101 @@
+package openai
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// costCounter is the counter of the cost of the requests in USD, labelled by provider, model and flow.
+// It is created on first use, so that a MeterProvider can be set first, as for the metrics of Genkit.
+var costCounter = sync.OnceValue(func() metric.Float64Counter {
+	counter, err := otel.Meter("genkit").Float64Counter("openai/cost",
+		metric.WithUnit("USD"),
+		metric.WithDescription("Cost of the OpenAI requests"))
+	if err != nil {
+		// Do not fail the requests because the cost cannot be recorded.
+		slog.Default().Error("openai: cost counter initialization failed; no cost will be recorded", "err", err)
+		return nil
+	}
+	return counter
+})
+
+// modelPricing returns the price of the model: the one given in [Config.Pricing], or the one of the catalog.
+// Fine-tuned models are charged more than their base model, so they are only priced by their own entry.
+func (p *Plugin) modelPricing(model string) (Pricing, bool) {
+	if price, ok := p.pricing[model]; ok {
+		return price, true
+	}
+	if m, ok := p.models().models[model]; ok && m.Pricing != nil {
+		return *m.Pricing, true
+	}
+	return Pricing{}, false
+}
+
+// cost returns the cost in USD of a request with the given usage.
+// Cached and audio tokens are charged at their own price if it is set, and at the input or output price otherwise.
+func cost(u *ai.GenerationUsage, p Pricing) float64 {
+	or := func(price, fallback float64) float64 {
+		if price == 0 {
+			return fallback
+		}
+		return price
+	}
+	cachedInput := u.Custom[UsageCachedInputTokens]
+	audioInput := u.Custom[UsageInputAudioTokens]
+	audioOutput := u.Custom[UsageOutputAudioTokens]
+	textInput := float64(u.InputTokens) - cachedInput - audioInput
+	textOutput := float64(u.OutputTokens) - audioOutput
+	return (textInput*p.Input +
+		cachedInput*or(p.CachedInput, p.Input) +
+		audioInput*or(p.AudioInput, p.Input) +
+		textOutput*p.Output +
+		audioOutput*or(p.AudioOutput, p.Output)) / 1e6
+}
+
+// recordCost sets the cost of the response generated by the model in [ResponseCustom],
+// and adds it to the cost counter. The response is left alone if the price of the model is unknown.
+func (p *Plugin) recordCost(ctx context.Context, model string, resp *ai.GenerateResponse) {
+	custom, ok := resp.Custom.(*ResponseCustom)
+	price, known := p.modelPricing(model)
+	if !ok || !known || resp.Usage == nil {
+		return
+	}
+	custom.Cost = cost(resp.Usage, price)
+	if counter := costCounter(); counter != nil {
+		counter.Add(ctx, custom.Cost, metric.WithAttributes(costAttributes(ctx, p.provider, model)...))
+	}
+}
+
+// costAttributes returns the labels of the cost of a request to the model:
+// the provider, the model and, if set with [WithFlowName], the flow.
+func costAttributes(ctx context.Context, provider, model string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("provider", provider),
+		attribute.String("model", model),
+	}
+	if flow, ok := ctx.Value(flowNameKey{}).(string); ok {
+		attrs = append(attrs, attribute.String("flow", flow))
+	}
+	return attrs
+}
+
+// flowNameKey is the context key of the flow name set by [WithFlowName].
+type flowNameKey struct{}
+
+// WithFlowName returns a copy of ctx with the name of the flow that labels the cost of the requests
+// made with it, see [ResponseCustom]. Genkit does not tell the models which flow they run in,
+// so flows set it themselves, e.g.
+//
+//	genkit.DefineFlow("menuFlow", func(ctx context.Context, input string) (string, error) {
+//		ctx = openai.WithFlowName(ctx, "menuFlow")
+//		...
+//	})
+func WithFlowName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, flowNameKey{}, name)
+}
@@ -0,0 +1,100 @@
+package openai
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage *ai.GenerationUsage
+		price Pricing
+		want  float64
+	}{
+		{
+			name:  "text",
+			usage: &ai.GenerationUsage{InputTokens: 1000, OutputTokens: 500},
+			price: Pricing{Input: 2.5, Output: 10},
+			want:  (1000*2.5 + 500*10) / 1e6,
+		},
+		{
+			name: "cached input",
+			usage: &ai.GenerationUsage{
+				InputTokens:  1000,
+				OutputTokens: 500,
+				Custom:       map[string]float64{UsageCachedInputTokens: 400},
+			},
+			price: Pricing{Input: 2.5, CachedInput: 1.25, Output: 10},
+			want:  (600*2.5 + 400*1.25 + 500*10) / 1e6,
+		},
+		{
+			name: "audio",
+			usage: &ai.GenerationUsage{
+				InputTokens:  1000,
+				OutputTokens: 500,
+				Custom:       map[string]float64{UsageInputAudioTokens: 100, UsageOutputAudioTokens: 200},
+			},
+			price: Pricing{Input: 2.5, Output: 10, AudioInput: 100, AudioOutput: 200},
+			want:  (900*2.5 + 100*100 + 300*10 + 200*200) / 1e6,
+		},
+		{
+			name: "no cached input price",
+			usage: &ai.GenerationUsage{
+				InputTokens: 1000,
+				Custom:      map[string]float64{UsageCachedInputTokens: 400},
+			},
+			price: Pricing{Input: 30, Output: 60},
+			want:  1000 * 30 / 1e6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cost(tt.usage, tt.price); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelPricing(t *testing.T) {
+	p := &Plugin{pricing: map[string]Pricing{"ft:gpt-4o-mini-2024-07-18:acme::priced": {Input: 0.3, Output: 1.2}}}
+	tests := []struct {
+		model     string
+		want      Pricing
+		wantKnown bool
+	}{
+		{model: "gpt-4o-mini", want: Pricing{Input: 0.15, CachedInput: 0.075, Output: 0.6}, wantKnown: true},
+		{model: "ft:gpt-4o-mini-2024-07-18:acme::priced", want: Pricing{Input: 0.3, Output: 1.2}, wantKnown: true},
+		{model: "ft:gpt-4o-mini-2024-07-18:acme::other", wantKnown: false},
+		{model: "unknown", wantKnown: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			got, known := p.modelPricing(tt.model)
+			if got != tt.want || known != tt.wantKnown {
+				t.Errorf("modelPricing() = %+v, %v, want %+v, %v", got, known, tt.want, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestCostAttributes(t *testing.T) {
+	ctx := context.Background()
+	want := []attribute.KeyValue{attribute.String("provider", "openai"), attribute.String("model", "gpt-4o")}
+	if got := costAttributes(ctx, "openai", "gpt-4o"); !reflect.DeepEqual(got, want) {
+		t.Errorf("costAttributes() = %v, want %v", got, want)
+	}
+
+	want = append(want, attribute.String("flow", "menuFlow"))
+	if got := costAttributes(WithFlowName(ctx, "menuFlow"), "openai", "gpt-4o"); !reflect.DeepEqual(got, want) {
+		t.Errorf("costAttributes() with a flow = %v, want %v", got, want)
+	}
+}
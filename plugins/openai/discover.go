@@ -0,0 +1,153 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+)
+
+// DiscoveryConfig configures the discovery of the models of the account.
+// See [Config.Discovery].
+type DiscoveryConfig struct {
+	// Include are the patterns of the models to define, in the syntax of [path.Match],
+	// e.g. "ft:gpt-4o-mini:acme:*". If empty, all the models are included.
+	Include []string
+	// Exclude are the patterns of the models not to define. It takes precedence over Include.
+	Exclude []string
+}
+
+// match reports whether the named model passes the include and exclude filters.
+// Invalid patterns never match.
+func (c *DiscoveryConfig) match(name string) bool {
+	if c == nil {
+		return true
+	}
+	for _, p := range c.Exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(c.Include) == 0 {
+		return true
+	}
+	for _, p := range c.Include {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validate reports an error for invalid patterns.
+func (c *DiscoveryConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, p := range slices.Concat(c.Include, c.Exclude) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid model pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// RefreshModels lists the models of the account again and defines the new chat and embedding
+// models that pass the filters of [Config.Discovery], or all of them if it is nil.
+// It returns the names of the models it defined, or an error if the models cannot be listed,
+// in which case no model is defined.
+//
+// Genkit does not accept definitions after genkit.Init, so new models can only be defined
+// by calling RefreshModels before it, e.g. after changing the filters of [Config.Discovery].
+// After genkit.Init, RefreshModels returns an error if the account has new models;
+// the models that are already defined are not affected.
+func (p *Plugin) RefreshModels(ctx context.Context) (names []string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer func() {
+		// The registry of Genkit panics when an action is defined after genkit.Init.
+		if r := recover(); r != nil {
+			names, err = nil, fmt.Errorf("%s.RefreshModels: defining the new models: %v", provider, r)
+		}
+	}()
+	names, err = p.discoverModels(ctx, p.discovery)
+	if err != nil {
+		return nil, fmt.Errorf("%s.RefreshModels: %w", provider, err)
+	}
+	return names, nil
+}
+
+// RefreshModels refreshes the models of the default plugin. See [Plugin.RefreshModels].
+func RefreshModels(ctx context.Context) ([]string, error) {
+	return mustDefaultPlugin().RefreshModels(ctx)
+}
+
+// discoverModels defines the chat and embedding models of the account that pass the filters
+// and are not defined yet. It returns the names of the models it defined.
+//
+// requires p.mu
+func (p *Plugin) discoverModels(ctx context.Context, cfg *DiscoveryConfig) ([]string, error) {
+	names, err := p.listModels(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return p.defineModels(names), nil
+}
+
+// listModels lists the chat and embedding models of the account that pass the filters
+// and are described by the catalog, from the base model for fine-tuned models.
+// The models that pass the filters but are missing from the catalog are logged at the debug level.
+func (p *Plugin) listModels(ctx context.Context, cfg *DiscoveryConfig) ([]string, error) {
+	var names, skipped []string
+	iter := p.client.Models.ListAutoPaging(ctx)
+	for iter.Next() {
+		name := iter.Current().ID
+		if !cfg.match(name) {
+			continue
+		}
+		info, ok := p.LookupModelInfo(name)
+		if !ok {
+			skipped = append(skipped, name)
+			continue
+		}
+		if info.Type == ModelTypeChat || info.Type == ModelTypeEmbedding {
+			names = append(names, name)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("listing models: %w", err)
+	}
+	if len(skipped) > 0 {
+		slog.Debug("openai: skipped the listed models missing from the catalog; add them to Config.Catalog to define them",
+			"provider", p.provider, "models", skipped)
+	}
+	return names, nil
+}
+
+// defineModels defines the chat and embedding models with the given names that are not defined yet,
+// as they are described by the catalog. It returns the names of the models it defined.
+//
+// requires p.mu
+func (p *Plugin) defineModels(names []string) []string {
+	var defined []string
+	for _, name := range names {
+		info, _ := p.LookupModelInfo(name)
+		switch info.Type {
+		case ModelTypeChat:
+			if p.IsDefinedModel(name) {
+				continue
+			}
+			p.defineModel(name, info)
+		case ModelTypeEmbedding:
+			if p.IsDefinedEmbedder(name) {
+				continue
+			}
+			p.defineEmbedder(name)
+		default:
+			continue
+		}
+		defined = append(defined, name)
+	}
+	return defined
+}
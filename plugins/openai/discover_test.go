@@ -0,0 +1,138 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/firebase/genkit/go/genkit"
+	goopenai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+func TestDiscoveryConfigMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *DiscoveryConfig
+		want bool
+	}{
+		{name: "ft:gpt-4o-mini:acme::xyz", cfg: nil, want: true},
+		{name: "ft:gpt-4o-mini:acme::xyz", cfg: &DiscoveryConfig{}, want: true},
+		{name: "ft:gpt-4o-mini:acme::xyz", cfg: &DiscoveryConfig{Include: []string{"ft:*"}}, want: true},
+		{name: "gpt-4o", cfg: &DiscoveryConfig{Include: []string{"ft:*"}}, want: false},
+		{name: "ft:gpt-4o-mini:acme::xyz", cfg: &DiscoveryConfig{Include: []string{"ft:*"}, Exclude: []string{"*::xyz"}}, want: false},
+		{name: "gpt-4o", cfg: &DiscoveryConfig{Exclude: []string{"gpt-4*"}}, want: false},
+		{name: "gpt-4o", cfg: &DiscoveryConfig{Include: []string{"["}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %+v", tt.name, tt.cfg), func(t *testing.T) {
+			if got := tt.cfg.match(tt.name); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoveryConfigValidate(t *testing.T) {
+	if err := (&DiscoveryConfig{Include: []string{"ft:*"}, Exclude: []string{"*-preview"}}).validate(); err != nil {
+		t.Errorf("validate() error = %v", err)
+	}
+	if err := (&DiscoveryConfig{Exclude: []string{"gpt-[4"}}).validate(); err == nil {
+		t.Error("validate() expected an error for an invalid pattern")
+	}
+}
+
+func TestDiscoverModels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object": "list", "data": [
+			{"id": "gpt-4o", "object": "model", "created": 1715367049, "owned_by": "system"},
+			{"id": "dall-e-3", "object": "model", "created": 1698785189, "owned_by": "system"},
+			{"id": "ft:gpt-4o-mini-2024-07-18:acme::discover1", "object": "model", "created": 1730000000, "owned_by": "acme"},
+			{"id": "ft:gpt-4o-mini:acme:excluded:discover2", "object": "model", "created": 1730000000, "owned_by": "acme"},
+			{"id": "ft:davinci-002:acme::discover3", "object": "model", "created": 1730000000, "owned_by": "acme"},
+			{"id": "ft:gpt-3.5-turbo-0125:acme::discover4", "object": "model", "created": 1730000000, "owned_by": "acme"}
+		]}`)
+	}))
+	defer srv.Close()
+
+	p := &Plugin{
+		provider: "test-discover",
+		client: goopenai.NewClient(
+			option.WithAPIKey("test"),
+			option.WithBaseURL(srv.URL),
+			option.WithMaxRetries(0),
+		),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cfg := &DiscoveryConfig{Include: []string{"ft:*"}, Exclude: []string{"*:excluded:*"}}
+	got, err := p.discoverModels(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ft:gpt-4o-mini-2024-07-18:acme::discover1", "ft:gpt-3.5-turbo-0125:acme::discover4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverModels() = %v, want %v", got, want)
+	}
+	if !p.IsDefinedModel(want[0]) {
+		t.Errorf("model %q is not defined", want[0])
+	}
+
+	// The models that are already defined are skipped.
+	got, err = p.discoverModels(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("discoverModels() = %v, want none", got)
+	}
+}
+
+func TestRefreshModelsAfterInit(t *testing.T) {
+	// genkit.Init freezes the registry of the process, so it is called in a subprocess.
+	if os.Getenv("TEST_REFRESH_MODELS_AFTER_INIT") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestRefreshModelsAfterInit$")
+		cmd.Env = append(os.Environ(), "TEST_REFRESH_MODELS_AFTER_INIT=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object": "list", "data": [
+			{"id": "ft:gpt-4o-mini-2024-07-18:acme::refresh1", "object": "model", "created": 1730000000, "owned_by": "acme"}
+		]}`)
+	}))
+	defer srv.Close()
+
+	p := &Plugin{
+		provider: "test-refresh",
+		client: goopenai.NewClient(
+			option.WithAPIKey("test"),
+			option.WithBaseURL(srv.URL),
+			option.WithMaxRetries(0),
+		),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	genkit.Init(ctx, &genkit.Options{FlowAddr: "-"})
+
+	got, err := p.RefreshModels(context.Background())
+	if err == nil {
+		t.Errorf("RefreshModels() = %v, want an error", got)
+	}
+}
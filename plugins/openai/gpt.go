@@ -18,4 +18,24 @@ var (
 		SystemRole: true,
 		Media:      true,
 	}
+
+	// Audio describes model capabilities for GPT models with audio input and output, such as gpt-4o-audio-preview.
+	// Media is false since they do not accept images. Audio input and output are supported by the models
+	// with the audio modality in the catalog, see [ModelInfo.InputModalities] and [GenerationConfig.Modalities].
+	Audio = ai.ModelCapabilities{
+		Multiturn:  true,
+		Tools:      true,
+		SystemRole: true,
+		Media:      false,
+	}
+
+	// Reasoning describes model capabilities for reasoning models (o1, o3 and o4 families).
+	// Capabilities do not make a model a reasoning model: the catalog does, with [ModelInfo.Reasoning],
+	// or the name of the model; use [Plugin.DefineModelInfo] for reasoning models with other names.
+	Reasoning = ai.ModelCapabilities{
+		Multiturn:  true,
+		Tools:      true,
+		SystemRole: true,
+		Media:      true,
+	}
 )
@@ -0,0 +1,32 @@
+// Package tokencount connects the tokenizer package to the truncation of the openai plugin,
+// which cannot import the tokenizer since the tokenizer imports the plugin for its catalog.
+package tokencount
+
+import (
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Func counts the input tokens of the messages and tool definitions of a request
+// with the named encoding, e.g. "o200k_base".
+type Func func(encoding string, messages []*ai.Message, tools []*ai.ToolDefinition) (int, error)
+
+var counter struct {
+	mu    sync.Mutex
+	count Func
+}
+
+// Set sets the function counting tokens. It is called by the tokenizer package when it is imported.
+func Set(count Func) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	counter.count = count
+}
+
+// Get returns the function counting tokens, or nil if the tokenizer package is not imported.
+func Get() Func {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	return counter.count
+}
@@ -0,0 +1,65 @@
+package openai
+
+import (
+	goopenai "github.com/openai/openai-go"
+)
+
+// Logprobs holds the log probabilities of the tokens generated for a candidate.
+type Logprobs struct {
+	// Content holds the log probabilities of the message content tokens.
+	Content []TokenLogprob `json:"content,omitempty"`
+	// Refusal holds the log probabilities of the refusal message tokens.
+	Refusal []TokenLogprob `json:"refusal,omitempty"`
+}
+
+// TokenLogprob is the log probability of a generated token.
+type TokenLogprob struct {
+	Token string `json:"token"`
+	// Logprob is the log probability of the token, or -9999.0 if the token is very unlikely.
+	Logprob float64 `json:"logprob"`
+	// Bytes is the UTF-8 representation of the token, if any.
+	// Characters represented by several tokens are obtained by joining the bytes of the tokens.
+	Bytes []int64 `json:"bytes,omitempty"`
+	// TopLogprobs are the most likely tokens at this position, if requested with [GenerationConfig.TopLogprobs].
+	TopLogprobs []TopLogprob `json:"topLogprobs,omitempty"`
+}
+
+// TopLogprob is the log probability of an alternative token.
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int64 `json:"bytes,omitempty"`
+}
+
+// translateLogprobs returns the log probabilities of a choice, or nil if there are none.
+func translateLogprobs(content, refusal []goopenai.ChatCompletionTokenLogprob) *Logprobs {
+	if len(content) == 0 && len(refusal) == 0 {
+		return nil
+	}
+	return &Logprobs{
+		Content: translateTokenLogprobs(content),
+		Refusal: translateTokenLogprobs(refusal),
+	}
+}
+
+func translateTokenLogprobs(logprobs []goopenai.ChatCompletionTokenLogprob) []TokenLogprob {
+	if len(logprobs) == 0 {
+		return nil
+	}
+	out := make([]TokenLogprob, len(logprobs))
+	for i, lp := range logprobs {
+		out[i] = TokenLogprob{
+			Token:   lp.Token,
+			Logprob: lp.Logprob,
+			Bytes:   lp.Bytes,
+		}
+		for _, top := range lp.TopLogprobs {
+			out[i].TopLogprobs = append(out[i].TopLogprobs, TopLogprob{
+				Token:   top.Token,
+				Logprob: top.Logprob,
+				Bytes:   top.Bytes,
+			})
+		}
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+package openai
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+)
+
+// ImageDetail is the level of detail used by the model to process an image.
+// Low detail uses fewer tokens, high detail allows the model to see small details.
+// See https://platform.openai.com/docs/guides/vision/low-or-high-fidelity-image-understanding
+type ImageDetail string
+
+const (
+	ImageDetailAuto ImageDetail = "auto"
+	ImageDetailLow  ImageDetail = "low"
+	ImageDetailHigh ImageDetail = "high"
+)
+
+// imageDetailParam is the content type parameter holding the [ImageDetail] of a media part.
+const imageDetailParam = "detail"
+
+// supportedImageTypes are the MIME types of the images accepted by OpenAI models.
+var supportedImageTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+}
+
+// NewImagePart returns a media part holding an image to be processed with the given level of detail.
+// The image is given as a URL, a data URL, or its base64 encoded contents.
+func NewImagePart(contentType, image string, detail ImageDetail) *ai.Part {
+	return ai.NewMediaPart(mime.FormatMediaType(contentType, map[string]string{imageDetailParam: string(detail)}), image)
+}
+
+// media is the contents of a media part.
+type media struct {
+	// contentType is the MIME type of the media, without parameters.
+	contentType string
+	// params are the parameters of the part's content type, e.g. the image detail.
+	params map[string]string
+	// url is the URL of the media. Inline media is given as a base64 data URL.
+	url string
+	// data is the base64 encoded contents of inline media.
+	data string
+}
+
+// parseMedia returns the contents of a media part.
+// The part holds a URL, a data URL, or the media itself (raw or base64 encoded), in which case
+// the content type of the part is required.
+func parseMedia(part *ai.Part) (*media, error) {
+	m := &media{}
+	if part.ContentType != "" {
+		ct, params, err := mime.ParseMediaType(part.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content type %q: %w", part.ContentType, err)
+		}
+		m.contentType, m.params = ct, params
+	}
+
+	switch {
+	case strings.HasPrefix(part.Text, "data:"):
+		header, payload, ok := strings.Cut(strings.TrimPrefix(part.Text, "data:"), ",")
+		if !ok {
+			return nil, errors.New("invalid data URL: missing data")
+		}
+		dataType, encoding, _ := strings.Cut(header, ";")
+		if encoding == "base64" || strings.HasSuffix(encoding, ";base64") {
+			m.data = payload
+		} else {
+			decoded, err := url.PathUnescape(payload)
+			if err != nil {
+				return nil, fmt.Errorf("invalid data URL: %w", err)
+			}
+			m.data = base64.StdEncoding.EncodeToString([]byte(decoded))
+		}
+		switch {
+		case m.contentType == "":
+			m.contentType = dataType
+		case dataType != "" && dataType != m.contentType:
+			return nil, fmt.Errorf("content type %q does not match the data URL type %q", m.contentType, dataType)
+		}
+	case strings.HasPrefix(part.Text, "https://"), strings.HasPrefix(part.Text, "http://"):
+		m.url = part.Text
+		if m.contentType == "" {
+			// Best effort: the type is checked by OpenAI when it is unknown.
+			if u, err := url.Parse(part.Text); err == nil {
+				m.contentType, _, _ = mime.ParseMediaType(mime.TypeByExtension(path.Ext(u.Path)))
+			}
+		}
+		return m, nil
+	default:
+		if m.contentType == "" {
+			return nil, errors.New("content type is required for inline media")
+		}
+		if _, err := base64.StdEncoding.DecodeString(part.Text); err == nil {
+			m.data = part.Text
+		} else {
+			m.data = base64.StdEncoding.EncodeToString([]byte(part.Text))
+		}
+	}
+	if m.contentType == "" {
+		return nil, errors.New("content type is required for inline media")
+	}
+	m.url = "data:" + m.contentType + ";base64," + m.data
+	return m, nil
+}
+
+// convertMedia converts a media part into an image content part.
+func convertMedia(part *ai.Part) (goopenai.ChatCompletionContentPartUnionParam, error) {
+	m, err := parseMedia(part)
+	if err != nil {
+		return nil, err
+	}
+	if m.contentType != "" && !slices.Contains(supportedImageTypes, m.contentType) {
+		return nil, fmt.Errorf("unsupported media type %q: supported types are %s", m.contentType, strings.Join(supportedImageTypes, ", "))
+	}
+
+	detail := ImageDetail(m.params[imageDetailParam])
+	switch detail {
+	case "":
+		detail = ImageDetailAuto
+	case ImageDetailAuto, ImageDetailLow, ImageDetailHigh:
+	default:
+		return nil, fmt.Errorf("unsupported image detail %q", detail)
+	}
+
+	mediaPart := goopenai.ImagePart(m.url)
+	mediaPart.ImageURL.Value.Detail = goopenai.F(goopenai.ChatCompletionContentPartImageImageURLDetail(detail))
+	return mediaPart, nil
+}
+
+// audioFormats maps the MIME types of the audio accepted by OpenAI models to their input format.
+var audioFormats = map[string]string{
+	"audio/wav":   "wav",
+	"audio/wave":  "wav",
+	"audio/x-wav": "wav",
+	"audio/mpeg":  "mp3",
+	"audio/mp3":   "mp3",
+}
+
+// inputAudioContentPart is an input_audio content part, which is not supported by [goopenai] yet.
+// See https://platform.openai.com/docs/guides/audio
+type inputAudioContentPart struct {
+	Type       string     `json:"type"`
+	InputAudio inputAudio `json:"input_audio"`
+}
+
+type inputAudio struct {
+	// Data is the base64 encoded audio.
+	Data string `json:"data"`
+	// Format is the format of the audio, "wav" or "mp3".
+	Format string `json:"format"`
+}
+
+// mediaType returns the content type of a media part.
+// The type of a data URL is used if the part has no content type.
+func mediaType(part *ai.Part) string {
+	if part.ContentType != "" || !strings.HasPrefix(part.Text, "data:") {
+		return part.ContentType
+	}
+	ct, _, _ := strings.Cut(strings.TrimPrefix(part.Text, "data:"), ",")
+	return ct
+}
+
+// isAudio reports whether the part holds audio.
+func isAudio(part *ai.Part) bool {
+	return part.IsMedia() && strings.HasPrefix(mediaType(part), "audio/")
+}
+
+// isImage reports whether the part holds an image.
+func isImage(part *ai.Part) bool {
+	return part.IsMedia() && strings.HasPrefix(mediaType(part), "image/")
+}
+
+// convertAudio converts a media part into an input_audio content part.
+func convertAudio(part *ai.Part) (inputAudioContentPart, error) {
+	m, err := parseMedia(part)
+	if err != nil {
+		return inputAudioContentPart{}, err
+	}
+	if m.data == "" {
+		return inputAudioContentPart{}, errors.New("audio must be given inline as a data URL or base64 encoded data")
+	}
+	format, ok := audioFormats[m.contentType]
+	if !ok {
+		return inputAudioContentPart{}, fmt.Errorf("unsupported audio type %q: supported formats are wav and mp3", m.contentType)
+	}
+	return inputAudioContentPart{
+		Type: "input_audio",
+		InputAudio: inputAudio{
+			Data:   m.data,
+			Format: format,
+		},
+	}, nil
+}
@@ -3,7 +3,7 @@ package openai
 import (
 	"context"
 	"fmt"
-	"os"
+	"net/http"
 	"sync"
 
 	"github.com/firebase/genkit/go/ai"
@@ -18,201 +18,179 @@ const (
 	apiKeyEnv   = "OPENAI_API_KEY"
 )
 
+// state holds the default plugin, created by [Init].
 var state struct {
-	mu      sync.Mutex
-	initted bool
-	client  *goopenai.Client
+	mu     sync.Mutex
+	plugin *Plugin
 }
 
-var (
-	knownCaps = map[string]ai.ModelCapabilities{
-		goopenai.ChatModelGPT4o:       Multimodal,
-		goopenai.ChatModelGPT4oMini:   Multimodal,
-		goopenai.ChatModelGPT4Turbo:   Multimodal,
-		goopenai.ChatModelGPT4:        BasicText,
-		goopenai.ChatModelGPT3_5Turbo: BasicText,
-	}
-
-	modelsSupportingResponseFormats = []string{
-		goopenai.ChatModelGPT4o,
-		goopenai.ChatModelGPT4oMini,
-		goopenai.ChatModelGPT4Turbo,
-		goopenai.ChatModelGPT3_5Turbo,
-	}
-
-	knownEmbedders = []string{
-		string(goopenai.EmbeddingNewParamsModelTextEmbedding3Small),
-		string(goopenai.EmbeddingNewParamsModelTextEmbedding3Large),
-		string(goopenai.EmbeddingNewParamsModelTextEmbeddingAda002),
-	}
-)
-
 // Config is the configuration for the plugin.
 type Config struct {
+	// Provider is the namespace of the models and embedders of the plugin, "openai" by default.
+	// For example, the provider "openai-eu" defines the model "openai-eu/gpt-4o".
+	Provider string
 	// The API key to access the service.
 	// If empty, the values of the environment variables OPENAI_API_KEY will be consulted.
 	APIKey string
+	// BaseURL is the URL of the API, "https://api.openai.com/v1/" by default.
+	// It can point to a gateway, or to an OpenAI-compatible server such as vLLM or LiteLLM.
+	BaseURL string
+	// Organization is the ID of the organization sent in the OpenAI-Organization header.
+	// If empty, the value of the environment variable OPENAI_ORG_ID is used, if set.
+	Organization string
+	// Project is the ID of the project sent in the OpenAI-Project header.
+	// If empty, the value of the environment variable OPENAI_PROJECT_ID is used, if set.
+	Project string
+	// Headers are additional HTTP headers sent with every request.
+	Headers map[string]string
+	// HTTPClient is the HTTP client sending the requests, e.g. with a proxy or a custom transport.
+	// If nil, [http.DefaultClient] is used.
+	HTTPClient *http.Client
+	// StrictTools enables strict mode for function calling, which guarantees that the arguments
+	// generated by the model match the input schema of the tool.
+	// Input schemas are rewritten to the subset supported by strict mode, with optional fields made nullable.
+	// It can be overridden for each tool with [DefineTool] or [Plugin.ConfigureTool].
+	StrictTools bool
+	// Catalog describes additional models, or overrides the description of known models.
+	// It is merged over a copy of the catalog embedded in the package, so other plugins are not affected,
+	// and all the chat and embedding models of the merged catalog are defined by the plugin.
+	// Use [ParseCatalog] to load it from a file.
+	Catalog map[string]ModelInfo
+	// Discovery, if set, makes the plugin list the models of the account and define the chat and
+	// embedding models that are not in the catalog, such as fine-tuned models.
+	// The capabilities of the models are taken from the catalog, and fine-tuned models are described
+	// by their base model, or by the model it is a snapshot of if the snapshot is missing from the catalog.
+	// Models that cannot be described, such as snapshots missing from the catalog, are skipped and
+	// logged at the debug level; add them to Catalog to define them.
+	// Call [Plugin.RefreshModels] before genkit.Init to list the models again.
+	Discovery *DiscoveryConfig
+	// Aliases maps alias names to the models they stand for, e.g. "default-chat" to "gpt-4o-2024-08-06".
+	// Each alias is defined as a model that generates with its target, so that flows can be switched
+	// to another model or snapshot by changing the configuration. The target must be described
+	// by the catalog, and the alias must not be the name of a defined model.
+	// Use [Plugin.DefineAlias] for the targets defined with [Plugin.DefineModel].
+	Aliases map[string]string
+	// Truncation, if set, trims the history of the requests that do not fit the context window of the model,
+	// e.g. [DropOldest], with room left for [GenerationConfig.MaxOutputTokens]. The tokens of the requests
+	// are counted by the tokenizer package if it is imported, and estimated otherwise.
+	// Models whose context window is not in the catalog are not truncated.
+	Truncation Truncation
+	// ModelTruncation overrides Truncation for the models (or aliases) with the given names.
+	ModelTruncation map[string]Truncation
+	// Retry is the policy for retrying the requests that fail, e.g. with 429 Too Many Requests.
+	// If nil, the requests are retried twice with an exponential backoff.
+	Retry *RetryPolicy
+	// ModelRetry overrides Retry for the models (or aliases) and embedders with the given names.
+	ModelRetry map[string]*RetryPolicy
+	// Pricing overrides the prices of the catalog for the models with the given names.
+	// Fine-tuned models have no price unless they are given one here, since they are charged
+	// more than their base model.
+	// The cost of each response is computed from these prices, see [ResponseCustom].
+	Pricing map[string]Pricing
 }
 
-// Init initializes the plugin and all known models.
+// Init initializes the default plugin, which defines all known models, and the models of the account
+// if [Config.Discovery] is set. The package-level functions, such as [Model], use the default plugin.
 // After calling Init, you may call [DefineModel] to create and register any additional generative models.
-func Init(ctx context.Context, cfg *Config) (err error) {
-	if cfg == nil {
-		cfg = &Config{}
-	}
+// Use [New] to create other plugins, e.g. for other accounts.
+func Init(ctx context.Context, cfg *Config) error {
 	state.mu.Lock()
 	defer state.mu.Unlock()
-	if state.initted {
-		panic(provider + ".Init not called")
+	if state.plugin != nil {
+		panic(provider + ".Init already called")
 	}
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("%s.Init: %w", provider, err)
-		}
-	}()
-
-	apiKey := cfg.APIKey
-	if apiKey == "" {
-		apiKey = os.Getenv(apiKeyEnv)
-		if apiKey == "" {
-			return fmt.Errorf("OpenAI requires setting %s in the environment. You can get an API key at https://platform.openai.com/api-keys", apiKeyEnv)
-		}
-	}
-
-	client := goopenai.NewClient(
-		option.WithAPIKey(apiKey),
-	)
-	state.client = client
-	state.initted = true
-	for model, caps := range knownCaps {
-		defineModel(model, caps)
-	}
-	for _, e := range knownEmbedders {
-		defineEmbedder(e)
+	p, err := newPlugin(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("%s.Init: %w", provider, err)
 	}
+	state.plugin = p
 	return nil
 }
 
-// DefineModel defines an unknown model with the given name.
-// The second argument describes the capability of the model.
-// Use [IsDefinedModel] to determine if a model is already defined.
-// After [Init] is called, only the known models are defined.
-func DefineModel(name string, caps *ai.ModelCapabilities) (ai.Model, error) {
+// defaultPlugin returns the plugin created by [Init], or nil if Init was not called.
+func defaultPlugin() *Plugin {
 	state.mu.Lock()
 	defer state.mu.Unlock()
-	if !state.initted {
+	return state.plugin
+}
+
+// mustDefaultPlugin returns the plugin created by [Init], and panics if Init was not called.
+func mustDefaultPlugin() *Plugin {
+	p := defaultPlugin()
+	if p == nil {
 		panic(provider + ".Init not called")
 	}
-	var mc ai.ModelCapabilities
-	if caps == nil {
-		var ok bool
-		mc, ok = knownCaps[name]
-		if !ok {
-			return nil, fmt.Errorf("%s.DefineModel: called with unknown model %q and nil ModelCapabilities", provider, name)
-		}
-	} else {
-		mc = *caps
-	}
-	return defineModel(name, mc), nil
+	return p
 }
 
-// requires state.mu
-func defineModel(name string, caps ai.ModelCapabilities) ai.Model {
-	meta := &ai.ModelMetadata{
-		Label:    labelPrefix + " - " + name,
-		Supports: caps,
+// defaultProvider returns the provider of the default plugin.
+func defaultProvider() string {
+	if p := defaultPlugin(); p != nil {
+		return p.provider
 	}
-	return ai.DefineModel(provider, name, meta, func(
-		ctx context.Context,
-		input *ai.GenerateRequest,
-		cb func(context.Context, *ai.GenerateResponseChunk) error,
-	) (*ai.GenerateResponse, error) {
-		return generate(ctx, state.client, name, input, cb)
-	})
+	return provider
 }
 
-// IsDefinedModel reports whether the named [Model] is defined by this plugin.
-func IsDefinedModel(name string) bool {
-	return ai.IsDefinedModel(provider, name)
+// DefineModel defines an unknown model with the given name with the default plugin.
+// See [Plugin.DefineModel].
+func DefineModel(name string, caps *ai.ModelCapabilities) (ai.Model, error) {
+	return mustDefaultPlugin().DefineModel(name, caps)
 }
 
-// DefineEmbedder defines an embedder with a given name.
-func DefineEmbedder(name string) ai.Embedder {
-	state.mu.Lock()
-	defer state.mu.Unlock()
-	if !state.initted {
-		panic(provider + ".Init not called")
-	}
-	return defineEmbedder(name)
+// DefineModelInfo defines a chat model with the given name, which is described by info, with the default plugin.
+// See [Plugin.DefineModelInfo].
+func DefineModelInfo(name string, info ModelInfo) (ai.Model, error) {
+	return mustDefaultPlugin().DefineModelInfo(name, info)
 }
 
-// IsDefinedEmbedder reports whether the named [Embedder] is defined by this plugin.
-func IsDefinedEmbedder(name string) bool {
-	return ai.IsDefinedEmbedder(provider, name)
+// DefineAlias defines a model named alias that generates with the target model with the default plugin.
+// See [Plugin.DefineAlias].
+func DefineAlias(alias, target string) (ai.Model, error) {
+	return mustDefaultPlugin().DefineAlias(alias, target)
 }
 
-// requires state.mu
-func defineEmbedder(name string) ai.Embedder {
-	return ai.DefineEmbedder(provider, name, func(ctx context.Context, input *ai.EmbedRequest) (*ai.EmbedResponse, error) {
-		var data goopenai.EmbeddingNewParamsInputArrayOfStrings
-		for _, doc := range input.Documents {
-			for _, p := range doc.Content {
-				data = append(data, p.Text)
-			}
-		}
-
-		model := goopenai.EmbeddingNewParamsModel(name)
-
-		params := goopenai.EmbeddingNewParams{
-			Input:          goopenai.F[goopenai.EmbeddingNewParamsInputUnion](data),
-			Model:          goopenai.F(model),
-			EncodingFormat: goopenai.F(goopenai.EmbeddingNewParamsEncodingFormatFloat),
-		}
+// IsDefinedModel reports whether the named [Model] is defined by the default plugin.
+func IsDefinedModel(name string) bool {
+	return ai.IsDefinedModel(defaultProvider(), name)
+}
 
-		embRes, err := state.client.Embeddings.New(ctx, params)
-		if err != nil {
-			return nil, err
-		}
+// DefineEmbedder defines an embedder with a given name with the default plugin.
+func DefineEmbedder(name string) ai.Embedder {
+	return mustDefaultPlugin().DefineEmbedder(name)
+}
 
-		var res ai.EmbedResponse
-		for _, emb := range embRes.Data {
-			embedding := make([]float32, len(emb.Embedding))
-			for i, val := range emb.Embedding {
-				embedding[i] = float32(val)
-			}
-			res.Embeddings = append(res.Embeddings, &ai.DocumentEmbedding{Embedding: embedding})
-		}
-		return &res, nil
-	})
+// IsDefinedEmbedder reports whether the named [Embedder] is defined by the default plugin.
+func IsDefinedEmbedder(name string) bool {
+	return ai.IsDefinedEmbedder(defaultProvider(), name)
 }
 
-// Model returns the [ai.Model] with the given name.
+// Model returns the [ai.Model] of the default plugin with the given name.
 // It returns nil if the model was not defined.
 func Model(name string) ai.Model {
-	return ai.LookupModel(provider, name)
+	return ai.LookupModel(defaultProvider(), name)
 }
 
-// Embedder returns the [ai.Embedder] with the given name.
+// Embedder returns the [ai.Embedder] of the default plugin with the given name.
 // It returns nil if the embedder was not defined.
 func Embedder(name string) ai.Embedder {
-	return ai.LookupEmbedder(provider, name)
+	return ai.LookupEmbedder(defaultProvider(), name)
 }
 
-func generate(
+func (p *Plugin) generate(
 	ctx context.Context,
-	client *goopenai.Client,
 	model string,
+	info ModelInfo,
 	input *ai.GenerateRequest,
-	cb func(context.Context, *ai.GenerateResponseChunk) error, // TODO: implement streaming
+	cb func(context.Context, *ai.GenerateResponseChunk) error,
 ) (*ai.GenerateResponse, error) {
-	req, err := convertRequest(model, input)
+	req, extraFields, err := convertRequest(model, info, input, p.isStrictTool)
 	if err != nil {
 		return nil, err
 	}
-
-	res, err := client.Chat.Completions.New(ctx, req)
-	if err != nil {
-		return nil, err
+	// Retries are made by the model action, see [RetryPolicy].
+	opts := []option.RequestOption{option.WithMaxRetries(0)}
+	for k, v := range extraFields {
+		opts = append(opts, option.WithJSONSet(k, v))
 	}
 
 	jsonMode := false
@@ -220,8 +198,89 @@ func generate(
 		input.Output.Format == ai.OutputFormatJSON {
 		jsonMode = true
 	}
+	translateOpts := translateOptions{jsonMode: jsonMode}
+	// The config is valid, since the request was converted.
+	if c, _ := generationConfig(input.Config); c.Audio != nil {
+		translateOpts.audioFormat = c.Audio.Format
+	}
 
-	r := translateResponse(res, jsonMode)
+	// Send out the actual request.
+	if cb == nil {
+		res, err := p.client.Chat.Completions.New(ctx, req, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		r := translateResponse(res, translateOpts)
+		for _, c := range r.Candidates {
+			dropNullOptionalArguments(c.Message.Content, input.Tools, p.isStrictTool)
+		}
+		countCharactersAndImages(r, input)
+		r.Request = input
+		return r, nil
+	}
+
+	// Streaming version.
+	req.StreamOptions = goopenai.F(goopenai.ChatCompletionStreamOptionsParam{
+		IncludeUsage: goopenai.F(true),
+	})
+	stream := p.client.Chat.Completions.NewStreaming(ctx, req, opts...)
+	defer stream.Close()
+
+	var acc chatCompletionAccumulator
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.addChunk(chunk)
+		// Send content deltas to the callback.
+		for _, c := range chunk.Choices {
+			var parts []*ai.Part
+			if c.Delta.Content != "" {
+				parts = append(parts, ai.NewTextPart(c.Delta.Content))
+			}
+			if c.Delta.Refusal != "" {
+				parts = append(parts, ai.NewTextPart(c.Delta.Refusal))
+			}
+			if audio := deltaAudio(c.Delta); audio != nil {
+				if part := audioPart(audio.Data, translateOpts.audioFormat); audio.Data != "" && part != nil {
+					parts = append(parts, part)
+				}
+				if audio.Transcript != "" {
+					parts = append(parts, ai.NewTextPart(audio.Transcript))
+				}
+			}
+			// Tool calls are streamed as fragments, so they are only sent once the choice is finished.
+			if c.FinishReason != "" {
+				toolRequestParts := acc.toolRequestParts(c.Index)
+				dropNullOptionalArguments(toolRequestParts, input.Tools, p.isStrictTool)
+				parts = append(parts, toolRequestParts...)
+			}
+			if len(parts) == 0 {
+				continue
+			}
+			chunk := &ai.GenerateResponseChunk{
+				Content: parts,
+				Index:   int(c.Index),
+			}
+			if logprobs := translateLogprobs(c.Logprobs.Content, c.Logprobs.Refusal); logprobs != nil {
+				chunk.Custom = &CandidateCustom{Logprobs: logprobs}
+			}
+			if err := cb(ctx, chunk); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	r := translateResponse(&acc.ChatCompletion, translateOpts)
+	for _, c := range r.Candidates {
+		if audio := acc.choiceAudio(int64(c.Index)); audio != nil {
+			translateAudio(c.Message, audio, translateOpts.audioFormat)
+		}
+		dropNullOptionalArguments(c.Message.Content, input.Tools, p.isStrictTool)
+	}
+	countCharactersAndImages(r, input)
 	r.Request = input
 	return r, nil
 }
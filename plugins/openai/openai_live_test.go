@@ -77,6 +77,34 @@ func TestLive(t *testing.T) {
 		}
 	})
 
+	t.Run("generate streaming", func(t *testing.T) {
+		var out string
+		resp, err := ai.Generate(
+			ctx,                  //
+			model,                //
+			ai.WithCandidates(1), //
+			ai.WithTextPrompt("Write a sentence about a cat."), //
+			ai.WithStreaming(func(ctx context.Context, c *ai.GenerateResponseChunk) error {
+				for _, p := range c.Content {
+					out += p.Text
+				}
+				return nil
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out == "" {
+			t.Error("no chunks were streamed")
+		}
+		if got := resp.Text(); out != got {
+			t.Errorf("streamed %q, response %q", out, got)
+		}
+		if resp.Usage.InputTokens == 0 || resp.Usage.OutputTokens == 0 || resp.Usage.TotalTokens == 0 {
+			t.Errorf("Empty usage stats %#v", *resp.Usage)
+		}
+	})
+
 	t.Run("tool", func(t *testing.T) {
 		gablorkenTool := ai.DefineTool("gablorken", "use when need to calculate a gablorken",
 			func(ctx context.Context, input struct {
@@ -0,0 +1,391 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
+
+	goopenai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// Plugin is an instance of the OpenAI plugin: a client of the OpenAI API and the models and embedders
+// using it, defined under the provider of the plugin. Several plugins can be used in the same program,
+// e.g. for accounts with different keys, as long as their providers differ.
+type Plugin struct {
+	provider    string
+	client      *goopenai.Client
+	catalog     *catalog
+	strictTools bool
+	discovery   *DiscoveryConfig
+	truncation  Truncation
+	// modelTruncation holds the per-model overrides of truncation, keyed by model name.
+	modelTruncation map[string]Truncation
+	pricing         map[string]Pricing
+	retry           *RetryPolicy
+	modelRetry      map[string]*RetryPolicy
+
+	// mu serializes the definitions of models and embedders.
+	mu sync.Mutex
+	// definedModels holds the descriptions of the models defined by the plugin, keyed by name, except aliases.
+	definedModels map[string]ModelInfo
+
+	toolsMu sync.Mutex
+	// toolStrict holds the per-tool overrides of strictTools given to [Plugin.ConfigureTool], keyed by tool name.
+	toolStrict map[string]bool
+}
+
+// providers holds the providers of the plugins created by [New].
+var providers struct {
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+// releaseProvider records that the provider is no longer used, e.g. when [New] fails.
+func releaseProvider(name string) {
+	providers.mu.Lock()
+	defer providers.mu.Unlock()
+	delete(providers.used, name)
+}
+
+// useProvider records that a plugin uses the provider.
+// It reports false if the provider is already used.
+func useProvider(name string) bool {
+	providers.mu.Lock()
+	defer providers.mu.Unlock()
+	if providers.used[name] {
+		return false
+	}
+	if providers.used == nil {
+		providers.used = map[string]bool{}
+	}
+	providers.used[name] = true
+	return true
+}
+
+// New creates a plugin with the given configuration, and defines all known models under its provider,
+// and the models of the account if [Config.Discovery] is set.
+// After calling New, you may call [Plugin.DefineModel] to create and register any additional generative models.
+func New(ctx context.Context, cfg *Config) (*Plugin, error) {
+	p, err := newPlugin(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s.New: %w", provider, err)
+	}
+	return p, nil
+}
+
+// newPlugin creates a plugin as [New] does. Its errors are prefixed by [New] and [Init].
+func newPlugin(ctx context.Context, cfg *Config) (_ *Plugin, err error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv(apiKeyEnv)
+		if apiKey == "" {
+			return nil, fmt.Errorf("OpenAI requires setting %s in the environment. You can get an API key at https://platform.openai.com/api-keys", apiKeyEnv)
+		}
+	}
+
+	if err := cfg.Discovery.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Retry.validate(); err != nil {
+		return nil, err
+	}
+	for name, r := range cfg.ModelRetry {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	opts := []option.RequestOption{
+		option.WithAPIKey(apiKey),
+	}
+	if cfg.BaseURL != "" {
+		// The paths of the requests are resolved relative to the base URL,
+		// so "http://host/v1" must end with a slash for them to be under /v1.
+		baseURL := cfg.BaseURL
+		if !strings.HasSuffix(baseURL, "/") {
+			baseURL += "/"
+		}
+		opts = append(opts, option.WithBaseURL(baseURL))
+	}
+	if cfg.Organization != "" {
+		opts = append(opts, option.WithOrganization(cfg.Organization))
+	}
+	if cfg.Project != "" {
+		opts = append(opts, option.WithProject(cfg.Project))
+	}
+	if cfg.HTTPClient != nil {
+		opts = append(opts, option.WithHTTPClient(cfg.HTTPClient))
+	}
+	for k, v := range cfg.Headers {
+		opts = append(opts, option.WithHeader(k, v))
+	}
+
+	p := &Plugin{
+		provider:        cfg.Provider,
+		client:          goopenai.NewClient(opts...),
+		catalog:         knownModels.with(cfg.Catalog),
+		strictTools:     cfg.StrictTools,
+		discovery:       cfg.Discovery,
+		truncation:      cfg.Truncation,
+		modelTruncation: cfg.ModelTruncation,
+		pricing:         cfg.Pricing,
+		retry:           cfg.Retry,
+		modelRetry:      cfg.ModelRetry,
+	}
+	if p.retry == nil {
+		p.retry = defaultRetryPolicy
+	}
+	if p.provider == "" {
+		p.provider = provider
+	}
+	if !useProvider(p.provider) {
+		return nil, fmt.Errorf("provider %q is already used by another plugin", p.provider)
+	}
+	defer func() {
+		if err != nil {
+			releaseProvider(p.provider)
+		}
+	}()
+
+	// Everything that can fail is done before the models are defined,
+	// so that New can be called again with the same provider if it fails.
+	names := slices.Concat(p.catalog.byType(ModelTypeChat), p.catalog.byType(ModelTypeEmbedding))
+	if cfg.Discovery != nil {
+		discovered, err := p.listModels(ctx, cfg.Discovery)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, discovered...)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	aliases := slices.Sorted(maps.Keys(cfg.Aliases))
+	targets := make([]ModelInfo, len(aliases))
+	for i, alias := range aliases {
+		if slices.Contains(names, alias) {
+			return nil, fmt.Errorf("alias %q: a model with this name is already defined", alias)
+		}
+		if targets[i], err = p.aliasTarget(alias, cfg.Aliases[alias]); err != nil {
+			return nil, err
+		}
+	}
+
+	p.defineModels(names)
+	for i, alias := range aliases {
+		p.defineAliasFor(alias, cfg.Aliases[alias], targets[i])
+	}
+	return p, nil
+}
+
+// Provider returns the provider of the models and embedders of the plugin, e.g. "openai".
+func (p *Plugin) Provider() string {
+	return p.provider
+}
+
+// DefineModel defines an unknown model with the given name.
+// The second argument describes the capability of the model.
+// Requests that need other capabilities fail with an [UnsupportedCapabilityError].
+// The rest of the description is taken from the catalog, if the model is known; otherwise
+// the model is a reasoning model if its name is the name of one (e.g. "o1-preview").
+// Use [Plugin.DefineModelInfo] to describe the model fully, e.g. a reasoning model with another name
+// or a model with audio input and output.
+// Use [Plugin.IsDefinedModel] to determine if a model is already defined.
+// After [New] is called, only the known models are defined.
+func (p *Plugin) DefineModel(name string, caps *ai.ModelCapabilities) (ai.Model, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, ok := p.LookupModelInfo(name)
+	if caps == nil {
+		if !ok || info.Type != ModelTypeChat {
+			return nil, fmt.Errorf("%s.DefineModel: called with unknown model %q and nil ModelCapabilities", provider, name)
+		}
+	} else {
+		if !ok {
+			info = ModelInfo{Type: ModelTypeChat, Reasoning: isReasoningModelName(name)}
+		}
+		info.Supports = *caps
+	}
+	return p.defineModel(name, info), nil
+}
+
+// DefineModelInfo defines a chat model with the given name, which is described by info,
+// e.g. ModelInfo{Supports: openai.Reasoning, Reasoning: true} for a deployment of a reasoning model.
+// Audio input and output are supported if they are in the InputModalities and OutputModalities of info.
+// Use [Plugin.IsDefinedModel] to determine if a model is already defined.
+func (p *Plugin) DefineModelInfo(name string, info ModelInfo) (ai.Model, error) {
+	if info.Type == "" {
+		info.Type = ModelTypeChat
+	}
+	if info.Type != ModelTypeChat {
+		return nil, fmt.Errorf("%s.DefineModelInfo: model %q has type %q, want %q", provider, name, info.Type, ModelTypeChat)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.defineModel(name, info), nil
+}
+
+// requires p.mu
+func (p *Plugin) defineModel(name string, info ModelInfo) ai.Model {
+	if p.definedModels == nil {
+		p.definedModels = map[string]ModelInfo{}
+	}
+	m := p.defineModelFor(name, name, labelPrefix+" - "+name, info)
+	p.definedModels[name] = info
+	return m
+}
+
+// defineModelFor defines a model with the given name that generates with the target model,
+// which is described by info.
+//
+// requires p.mu
+func (p *Plugin) defineModelFor(name, target, label string, info ModelInfo) ai.Model {
+	caps := info.Supports
+	// NOTE: ai.DefineModel does not support a config schema, so the model action is defined directly
+	// with the same metadata plus the schema of GenerationConfig for the Genkit Developer UI.
+	modelMetadata := map[string]any{
+		"label": label,
+		"supports": map[string]bool{
+			"media":      caps.Media,
+			"multiturn":  caps.Multiturn,
+			"systemRole": caps.SystemRole,
+			"tools":      caps.Tools,
+		},
+	}
+	// The schema of GenerationConfig can always be inferred; without it, the Developer UI only lacks the form of the config.
+	if schema, err := inferJSONSchema(GenerationConfig{}); err == nil {
+		modelMetadata["customOptions"] = schema
+	}
+	metadata := map[string]any{"model": modelMetadata}
+	core.DefineStreamingAction(p.provider, name, "model", metadata, func(
+		ctx context.Context,
+		input *ai.GenerateRequest,
+		cb func(context.Context, *ai.GenerateResponseChunk) error,
+	) (*ai.GenerateResponse, error) {
+		if err := validateRequest(target, info, input); err != nil {
+			return nil, err
+		}
+		truncation, ok := p.modelTruncation[name]
+		if !ok {
+			truncation = p.truncation
+		}
+		req, err := truncateRequest(ctx, target, info, input, truncation)
+		if err != nil {
+			return nil, err
+		}
+		// The truncation may add messages, e.g. a summary.
+		if req != input {
+			if err := validateRequest(target, info, req); err != nil {
+				return nil, err
+			}
+		}
+		// The request is not retried once chunks have been sent.
+		var streamed bool
+		if cb != nil {
+			sendChunk := cb
+			cb = func(ctx context.Context, chunk *ai.GenerateResponseChunk) error {
+				streamed = true
+				return sendChunk(ctx, chunk)
+			}
+		}
+		var resp *ai.GenerateResponse
+		err = p.retryPolicy(name).do(ctx, func(ctx context.Context) error {
+			r, err := p.generate(ctx, target, info, req, cb)
+			if err != nil && streamed {
+				return &permanentError{err}
+			}
+			resp = r
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The response refers to the full history, which is the history of the next turn.
+		resp.Request = input
+		p.recordCost(ctx, target, resp)
+		if err := jsonOutputError(input, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+	return ai.LookupModel(p.provider, name)
+}
+
+// IsDefinedModel reports whether the named [Model] is defined by the plugin.
+func (p *Plugin) IsDefinedModel(name string) bool {
+	return ai.IsDefinedModel(p.provider, name)
+}
+
+// DefineEmbedder defines an embedder with a given name.
+func (p *Plugin) DefineEmbedder(name string) ai.Embedder {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.defineEmbedder(name)
+}
+
+// IsDefinedEmbedder reports whether the named [Embedder] is defined by the plugin.
+func (p *Plugin) IsDefinedEmbedder(name string) bool {
+	return ai.IsDefinedEmbedder(p.provider, name)
+}
+
+// requires p.mu
+func (p *Plugin) defineEmbedder(name string) ai.Embedder {
+	return ai.DefineEmbedder(p.provider, name, func(ctx context.Context, input *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		var data goopenai.EmbeddingNewParamsInputArrayOfStrings
+		for _, doc := range input.Documents {
+			for _, part := range doc.Content {
+				data = append(data, part.Text)
+			}
+		}
+
+		model := goopenai.EmbeddingNewParamsModel(name)
+
+		params := goopenai.EmbeddingNewParams{
+			Input:          goopenai.F[goopenai.EmbeddingNewParamsInputUnion](data),
+			Model:          goopenai.F(model),
+			EncodingFormat: goopenai.F(goopenai.EmbeddingNewParamsEncodingFormatFloat),
+		}
+
+		var embRes *goopenai.CreateEmbeddingResponse
+		err := p.retryPolicy(name).do(ctx, func(ctx context.Context) (err error) {
+			embRes, err = p.client.Embeddings.New(ctx, params, option.WithMaxRetries(0))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var res ai.EmbedResponse
+		for _, emb := range embRes.Data {
+			embedding := make([]float32, len(emb.Embedding))
+			for i, val := range emb.Embedding {
+				embedding[i] = float32(val)
+			}
+			res.Embeddings = append(res.Embeddings, &ai.DocumentEmbedding{Embedding: embedding})
+		}
+		return &res, nil
+	})
+}
+
+// Model returns the [ai.Model] of the plugin with the given name.
+// It returns nil if the model was not defined.
+func (p *Plugin) Model(name string) ai.Model {
+	return ai.LookupModel(p.provider, name)
+}
+
+// Embedder returns the [ai.Embedder] of the plugin with the given name.
+// It returns nil if the embedder was not defined.
+func (p *Plugin) Embedder(name string) ai.Embedder {
+	return ai.LookupEmbedder(p.provider, name)
+}
@@ -0,0 +1,227 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+	prod, err := New(ctx, &Config{APIKey: "test", Provider: "test-prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := New(ctx, &Config{APIKey: "test", Provider: "test-batch", Aliases: map[string]string{"default-chat": "gpt-4o-mini"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		plugin *Plugin
+		model  string
+		want   string
+	}{
+		{plugin: prod, model: "gpt-4o", want: "test-prod/gpt-4o"},
+		{plugin: batch, model: "gpt-4o", want: "test-batch/gpt-4o"},
+		{plugin: batch, model: "default-chat", want: "test-batch/default-chat"},
+	} {
+		if !tt.plugin.IsDefinedModel(tt.model) {
+			t.Errorf("%s: model %q is not defined", tt.plugin.Provider(), tt.model)
+			continue
+		}
+		if got := tt.plugin.Model(tt.model).Name(); got != tt.want {
+			t.Errorf("%s.Model(%q).Name() = %q, want %q", tt.plugin.Provider(), tt.model, got, tt.want)
+		}
+	}
+	if prod.IsDefinedModel("default-chat") {
+		t.Error("the alias of a plugin is defined by another plugin")
+	}
+	if !batch.IsDefinedEmbedder("text-embedding-3-small") {
+		t.Error("the embedders of the catalog are not defined")
+	}
+
+	if _, err := New(ctx, &Config{APIKey: "test", Provider: "test-prod"}); err == nil {
+		t.Error("New() expected an error for a provider that is already used")
+	}
+}
+
+func TestNewWithoutAPIKey(t *testing.T) {
+	t.Setenv(apiKeyEnv, "")
+	_, err := New(context.Background(), &Config{Provider: "test-no-key"})
+	if err == nil {
+		t.Fatal("New() expected an error without an API key")
+	}
+	// The error is prefixed once, by the package name.
+	if msg := err.Error(); !strings.HasPrefix(msg, "openai.New: ") || strings.Count(msg, ": ") != 1 {
+		t.Errorf("New() error = %q, want a single %q prefix", msg, "openai.New: ")
+	}
+}
+
+// roundTripFunc is an [http.RoundTripper] calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestNewClientOptions(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		got = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"object": "list",
+			"model": "text-embedding-3-small",
+			"data": [{"object": "embedding", "index": 0, "embedding": [0.5, 1]}],
+			"usage": {"prompt_tokens": 1, "total_tokens": 1}
+		}`)
+	}))
+	defer srv.Close()
+
+	var sent int
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent++
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	p, err := New(context.Background(), &Config{
+		Provider:     "test-client-options",
+		APIKey:       "test",
+		BaseURL:      srv.URL + "/v1/",
+		Organization: "org-test",
+		Project:      "proj-test",
+		Headers:      map[string]string{"X-Gateway-Key": "gateway-test"},
+		HTTPClient:   httpClient,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := p.Embedder("text-embedding-3-small").Embed(context.Background(), &ai.EmbedRequest{
+		Documents: []*ai.Document{ai.DocumentFromText("Hello", nil)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Embeddings) != 1 {
+		t.Errorf("got %d embeddings, want 1", len(resp.Embeddings))
+	}
+	if sent != 1 {
+		t.Errorf("the HTTP client sent %d requests, want 1", sent)
+	}
+	for header, want := range map[string]string{
+		"Authorization":       "Bearer test",
+		"OpenAI-Organization": "org-test",
+		"OpenAI-Project":      "proj-test",
+		"X-Gateway-Key":       "gateway-test",
+	} {
+		if v := got.Get(header); v != want {
+			t.Errorf("header %s = %q, want %q", header, v, want)
+		}
+	}
+}
+
+func TestNewBaseURLWithoutSlash(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"object": "list",
+			"model": "text-embedding-3-small",
+			"data": [{"object": "embedding", "index": 0, "embedding": [0.5, 1]}],
+			"usage": {"prompt_tokens": 1, "total_tokens": 1}
+		}`)
+	}))
+	defer srv.Close()
+
+	p, err := New(context.Background(), &Config{Provider: "test-base-url", APIKey: "test", BaseURL: srv.URL + "/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Embedder("text-embedding-3-small").Embed(context.Background(), &ai.EmbedRequest{
+		Documents: []*ai.Document{ai.DocumentFromText("Hello", nil)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/embeddings" {
+		t.Errorf("request path = %q, want %q", path, "/v1/embeddings")
+	}
+}
+
+func TestNewCatalog(t *testing.T) {
+	ctx := context.Background()
+	a, err := New(ctx, &Config{APIKey: "test", Provider: "test-catalog-a", Catalog: map[string]ModelInfo{
+		"test-catalog-model": {Type: ModelTypeChat, Supports: BasicText},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(ctx, &Config{APIKey: "test", Provider: "test-catalog-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.LookupModelInfo("test-catalog-model"); !ok || !a.IsDefinedModel("test-catalog-model") {
+		t.Error("the model of the catalog of the plugin is not defined")
+	}
+	if _, ok := b.LookupModelInfo("test-catalog-model"); ok || b.IsDefinedModel("test-catalog-model") {
+		t.Error("the catalog of a plugin is used by another plugin")
+	}
+	if _, ok := knownModels.lookup("test-catalog-model"); ok {
+		t.Error("the catalog of a plugin modified the embedded catalog")
+	}
+}
+
+func TestNewReleasesProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error"}}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{APIKey: "test", Provider: "test-release", BaseURL: srv.URL, Discovery: &DiscoveryConfig{}}
+	if _, err := New(context.Background(), cfg); err == nil {
+		t.Fatal("New() expected an error when the models cannot be listed")
+	}
+	cfg.Discovery = nil
+	if _, err := New(context.Background(), cfg); err != nil {
+		t.Errorf("New() error = %v after a failed New() with the same provider", err)
+	}
+}
+
+func TestConfigureTool(t *testing.T) {
+	type input struct {
+		City string `json:"city"`
+	}
+	ai.DefineTool("test-configure-tool", "Get the weather.", func(ctx context.Context, in input) (string, error) {
+		return "sunny", nil
+	})
+
+	strict := &Plugin{provider: "test-strict", strictTools: true}
+	lax := &Plugin{provider: "test-lax"}
+	if !strict.isStrictTool("test-configure-tool") || lax.isStrictTool("test-configure-tool") {
+		t.Error("the tools are not called in the strict mode of their plugin")
+	}
+
+	no := false
+	if err := strict.ConfigureTool("test-configure-tool", &ToolConfig{Strict: &no}); err != nil {
+		t.Fatal(err)
+	}
+	if strict.isStrictTool("test-configure-tool") {
+		t.Error("ConfigureTool() did not override the strict mode of the plugin")
+	}
+	err := lax.ConfigureTool("test-unknown-tool", nil)
+	if err == nil {
+		t.Fatal("ConfigureTool() expected an error for an unknown tool")
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "openai.ConfigureTool: ") {
+		t.Errorf("ConfigureTool() error = %q, want the prefix %q", msg, "openai.ConfigureTool: ")
+	}
+}
@@ -0,0 +1,33 @@
+package openai
+
+import (
+	"regexp"
+	"strings"
+
+	goopenai "github.com/openai/openai-go"
+)
+
+// reasoningModelRegexp matches the names of reasoning models, including their snapshots.
+var reasoningModelRegexp = regexp.MustCompile(`^o[134](-|$)`)
+
+// isReasoningModelName reports whether the name is the name of a reasoning model,
+// for the models missing from the catalog.
+// Fine-tuned models (e.g. "ft:o1-mini:org::id") are recognized by their base model.
+func isReasoningModelName(model string) bool {
+	return reasoningModelRegexp.MatchString(strings.TrimPrefix(model, "ft:"))
+}
+
+// developerMessages returns the messages with system messages turned into developer messages,
+// since the system role is not supported by reasoning models.
+func developerMessages(messages []goopenai.ChatCompletionMessageParamUnion) []goopenai.ChatCompletionMessageParamUnion {
+	out := make([]goopenai.ChatCompletionMessageParamUnion, len(messages))
+	for i, m := range messages {
+		if sm, ok := m.(goopenai.ChatCompletionSystemMessageParam); ok {
+			// NOTE: The developer role is not supported by goopenai yet.
+			sm.Role = goopenai.Raw[goopenai.ChatCompletionSystemMessageParamRole]("developer")
+			m = sm
+		}
+		out[i] = m
+	}
+	return out
+}
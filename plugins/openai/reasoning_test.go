@@ -0,0 +1,203 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+func TestIsReasoningModelName(t *testing.T) {
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{model: "o1", want: true},
+		{model: "o1-mini", want: true},
+		{model: "o1-2024-12-17", want: true},
+		{model: "o3-mini", want: true},
+		{model: "o4-mini", want: true},
+		{model: "ft:o1-mini:acme::xyz", want: true},
+		{model: "gpt-4o", want: false},
+		{model: "gpt-4o-mini", want: false},
+		{model: "omni-moderation-latest", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := isReasoningModelName(tt.model); got != tt.want {
+				t.Errorf("isReasoningModelName(%q) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertRequestReasoning(t *testing.T) {
+	req := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleSystem,
+				Content: []*ai.Part{ai.NewTextPart("Answer briefly.")},
+			},
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewTextPart("How many r's are in strawberry?")},
+			},
+		},
+		Config: &GenerationConfig{
+			GenerationCommonConfig: ai.GenerationCommonConfig{
+				MaxOutputTokens: 1000,
+				Temperature:     0.7,
+				TopP:            0.9,
+			},
+			PresencePenalty: 0.5,
+			Logprobs:        true,
+			ReasoningEffort: "low",
+		},
+	}
+
+	got, gotExtraFields, err := convertRequest("o1", testModelInfo("o1"), req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := goopenai.ChatCompletionNewParams{
+		Model: goopenai.F("o1"),
+		Messages: goopenai.F([]goopenai.ChatCompletionMessageParamUnion{
+			goopenai.ChatCompletionSystemMessageParam{
+				Role: goopenai.Raw[goopenai.ChatCompletionSystemMessageParamRole]("developer"),
+				Content: goopenai.F([]goopenai.ChatCompletionContentPartTextParam{
+					goopenai.TextPart("Answer briefly."),
+				}),
+			},
+			goopenai.UserMessageParts(goopenai.TextPart("How many r's are in strawberry?")),
+		}),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("convertRequest() = %#v, want %#v", got, want)
+	}
+	wantExtraFields := map[string]any{
+		"max_completion_tokens": 1000,
+		"reasoning_effort":      "low",
+	}
+	if !reflect.DeepEqual(gotExtraFields, wantExtraFields) {
+		t.Errorf("convertRequest() extra fields = %#v, want %#v", gotExtraFields, wantExtraFields)
+	}
+}
+
+func TestDefineModelReasoning(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"created": 1,
+			"model": "my-deployment",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "3"}}]
+		}`)
+	}))
+	defer srv.Close()
+
+	p := &Plugin{
+		provider: "test-reasoning-profile",
+		client: goopenai.NewClient(
+			option.WithAPIKey("test"),
+			option.WithBaseURL(srv.URL),
+		),
+	}
+	req := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			ai.NewSystemTextMessage("Answer briefly."),
+			ai.NewUserTextMessage("How many r's are in strawberry?"),
+		},
+		Config: &GenerationConfig{
+			GenerationCommonConfig: ai.GenerationCommonConfig{MaxOutputTokens: 1000, Temperature: 0.7},
+		},
+	}
+
+	tests := []struct {
+		model           string
+		caps            *ai.ModelCapabilities
+		reasoning       bool
+		wantRole        string
+		wantMaxTokens   string
+		wantTemperature bool
+	}{
+		{model: "my-o1-deployment", caps: &Reasoning, reasoning: true, wantRole: "developer", wantMaxTokens: "max_completion_tokens", wantTemperature: false},
+		{model: "o1-preview", caps: &Reasoning, wantRole: "developer", wantMaxTokens: "max_completion_tokens", wantTemperature: false},
+		{model: "my-gpt-deployment", caps: &Multimodal, wantRole: "system", wantMaxTokens: "max_tokens", wantTemperature: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			var m ai.Model
+			var err error
+			if tt.reasoning {
+				m, err = p.DefineModelInfo(tt.model, ModelInfo{Supports: *tt.caps, Reasoning: true})
+			} else {
+				m, err = p.DefineModel(tt.model, tt.caps)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Generate(context.Background(), req, nil); err != nil {
+				t.Fatal(err)
+			}
+			messages, _ := body["messages"].([]any)
+			if len(messages) == 0 {
+				t.Fatalf("request messages = %v", body["messages"])
+			}
+			if role := messages[0].(map[string]any)["role"]; role != tt.wantRole {
+				t.Errorf("role of the system message = %v, want %q", role, tt.wantRole)
+			}
+			if _, ok := body[tt.wantMaxTokens]; !ok {
+				t.Errorf("request has no %s: %v", tt.wantMaxTokens, body)
+			}
+			if _, ok := body["temperature"]; ok != tt.wantTemperature {
+				t.Errorf("request has temperature = %v, want %v", ok, tt.wantTemperature)
+			}
+		})
+	}
+}
+
+func TestTranslateResponseReasoningTokens(t *testing.T) {
+	var resp goopenai.ChatCompletion
+	err := json.Unmarshal([]byte(`{
+		"id": "chatcmpl-1",
+		"object": "chat.completion",
+		"created": 1,
+		"model": "o1",
+		"choices": [],
+		"usage": {
+			"prompt_tokens": 20,
+			"completion_tokens": 300,
+			"total_tokens": 320,
+			"completion_tokens_details": {"reasoning_tokens": 256}
+		}
+	}`), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := translateResponse(&resp, translateOptions{})
+	want := &ai.GenerationUsage{
+		InputTokens:  20,
+		OutputTokens: 300,
+		TotalTokens:  320,
+		Custom:       map[string]float64{UsageReasoningTokens: 256},
+	}
+	if !reflect.DeepEqual(got.Usage, want) {
+		t.Errorf("translateResponse() usage = %#v, want %#v", got.Usage, want)
+	}
+}
@@ -0,0 +1,246 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	goopenai "github.com/openai/openai-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorClass is a class of errors that can be retried.
+type ErrorClass string
+
+const (
+	// RetryRateLimit is the class of the responses with status 429 Too Many Requests.
+	RetryRateLimit ErrorClass = "rateLimit"
+	// RetryServerError is the class of the responses with a 5xx status.
+	RetryServerError ErrorClass = "serverError"
+	// RetryTimeout is the class of the responses with status 408 Request Timeout.
+	RetryTimeout ErrorClass = "timeout"
+	// RetryConnection is the class of the errors of the connection, e.g. when it is reset.
+	RetryConnection ErrorClass = "connection"
+)
+
+// RetryPolicy describes how failed requests are retried.
+// The zero value of a field stands for its default value, except for Jitter.
+//
+// The delay before a retry is the one requested by the API, in the Retry-After header or,
+// if the rate limit is reached, the x-ratelimit-reset-* headers. Otherwise the delay grows
+// exponentially from BaseBackoff to MaxBackoff, less a random part of up to Jitter times the delay.
+// A request is not retried if the API requests a delay longer than MaxBackoff, in which case
+// its error is returned, nor if the delay would exceed the deadline of its context,
+// nor once chunks of a streaming response have been sent to the callback.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one, 3 by default.
+	// Set it to 1 to disable retries.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry, 500ms by default.
+	BaseBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts, 8s by default.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the delay that is randomized, between 0 and 1.
+	Jitter float64
+	// RetryOn is the classes of the errors that are retried, all of them by default.
+	RetryOn []ErrorClass
+}
+
+// defaultRetryPolicy is the policy of the plugins when [Config.Retry] is not set.
+// It matches the default of the OpenAI client.
+var defaultRetryPolicy = &RetryPolicy{Jitter: 0.25}
+
+// withDefaults returns a copy of the policy with the default values of the fields that are not set.
+func (r *RetryPolicy) withDefaults() *RetryPolicy {
+	c := *r
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.BaseBackoff <= 0 {
+		c.BaseBackoff = 500 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 8 * time.Second
+	}
+	if len(c.RetryOn) == 0 {
+		c.RetryOn = []ErrorClass{RetryRateLimit, RetryServerError, RetryTimeout, RetryConnection}
+	}
+	return &c
+}
+
+// validate returns an error if the policy is invalid.
+func (r *RetryPolicy) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("retry jitter %v is not between 0 and 1", r.Jitter)
+	}
+	for _, c := range r.RetryOn {
+		switch c {
+		case RetryRateLimit, RetryServerError, RetryTimeout, RetryConnection:
+		default:
+			return fmt.Errorf("unknown retry error class %q", c)
+		}
+	}
+	return nil
+}
+
+// retryPolicy returns the retry policy of the model (or embedder) with the given name.
+func (p *Plugin) retryPolicy(name string) *RetryPolicy {
+	if r, ok := p.modelRetry[name]; ok {
+		return r
+	}
+	return p.retry
+}
+
+// permanentError is an error that is not retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// do calls f until it succeeds, fails with an error that is not retried, or the attempts are exhausted.
+// f may return a [permanentError] to stop retrying. Each attempt is recorded as an event of the span of ctx.
+// A nil policy makes a single attempt.
+func (r *RetryPolicy) do(ctx context.Context, f func(context.Context) error) error {
+	if r == nil {
+		r = &RetryPolicy{MaxAttempts: 1}
+	}
+	r = r.withDefaults()
+	span := trace.SpanFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		attrs := []attribute.KeyValue{attribute.Int("attempt", attempt)}
+		if err == nil {
+			span.AddEvent("openai.attempt", trace.WithAttributes(attrs...))
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			err = perm.err
+		}
+		attrs = append(attrs, attribute.String("error", err.Error()))
+		var apiErr *goopenai.Error
+		if errors.As(err, &apiErr) {
+			attrs = append(attrs, attribute.Int("status", apiErr.StatusCode))
+		}
+
+		delay, retry := r.delay(ctx, attempt, err)
+		retry = retry && perm == nil
+		if retry {
+			attrs = append(attrs, attribute.Int64("delayMs", delay.Milliseconds()))
+		}
+		span.AddEvent("openai.attempt", trace.WithAttributes(attrs...))
+		if !retry {
+			if attempt > 1 {
+				return fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the delay before retrying the given attempt, which failed with err,
+// and reports whether it is retried.
+func (r *RetryPolicy) delay(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	if attempt >= r.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+	class, ok := errorClass(err)
+	if !ok || !slices.Contains(r.RetryOn, class) {
+		return 0, false
+	}
+
+	var d time.Duration
+	var requested bool
+	var apiErr *goopenai.Error
+	if errors.As(err, &apiErr) && apiErr.Response != nil {
+		d, requested = retryAfter(apiErr.Response.Header, time.Now())
+		if requested && d > r.MaxBackoff {
+			return 0, false
+		}
+	}
+	if !requested {
+		d = r.BaseBackoff * time.Duration(math.Pow(2, float64(attempt-1)))
+		if d <= 0 || d > r.MaxBackoff {
+			d = r.MaxBackoff
+		}
+		d -= time.Duration(r.Jitter * rand.Float64() * float64(d))
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+		return 0, false
+	}
+	return d, true
+}
+
+// errorClass returns the class of the error, if it can be retried.
+func errorClass(err error) (ErrorClass, bool) {
+	var apiErr *goopenai.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return RetryRateLimit, true
+		case apiErr.StatusCode == http.StatusRequestTimeout:
+			return RetryTimeout, true
+		case apiErr.StatusCode >= 500:
+			return RetryServerError, true
+		}
+		return "", false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return RetryConnection, true
+	}
+	return "", false
+}
+
+// retryAfter returns the delay requested by the headers of a response:
+// Retry-After-Ms or Retry-After, or the time until the exhausted rate limits are reset.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if s, err := strconv.ParseFloat(v, 64); err == nil && s >= 0 {
+			return time.Duration(s * float64(time.Second)), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(t.Sub(now), 0), true
+		}
+	}
+	// The reset times are durations, e.g. "1s" or "6m0s".
+	var d time.Duration
+	var ok bool
+	for _, limit := range []string{"requests", "tokens"} {
+		if h.Get("X-Ratelimit-Remaining-"+limit) != "0" {
+			continue
+		}
+		if reset, err := time.ParseDuration(h.Get("X-Ratelimit-Reset-" + limit)); err == nil && reset >= 0 {
+			d = max(d, reset)
+			ok = true
+		}
+	}
+	return d, ok
+}
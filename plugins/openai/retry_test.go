@@ -0,0 +1,253 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
+	goopenai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+		wantOK  bool
+	}{
+		{name: "none", headers: nil, want: 0, wantOK: false},
+		{name: "retry-after-ms", headers: map[string]string{"Retry-After-Ms": "250", "Retry-After": "1"}, want: 250 * time.Millisecond, wantOK: true},
+		{name: "retry-after seconds", headers: map[string]string{"Retry-After": "2"}, want: 2 * time.Second, wantOK: true},
+		{name: "retry-after date", headers: map[string]string{"Retry-After": "Tue, 01 Oct 2024 12:00:05 GMT"}, want: 5 * time.Second, wantOK: true},
+		{name: "retry-after past date", headers: map[string]string{"Retry-After": "Tue, 01 Oct 2024 11:00:00 GMT"}, want: 0, wantOK: true},
+		{
+			name: "tokens exhausted",
+			headers: map[string]string{
+				"X-Ratelimit-Remaining-Requests": "10",
+				"X-Ratelimit-Reset-Requests":     "1s",
+				"X-Ratelimit-Remaining-Tokens":   "0",
+				"X-Ratelimit-Reset-Tokens":       "6m0s",
+			},
+			want:   6 * time.Minute,
+			wantOK: true,
+		},
+		{
+			name: "both exhausted",
+			headers: map[string]string{
+				"X-Ratelimit-Remaining-Requests": "0",
+				"X-Ratelimit-Reset-Requests":     "1.5s",
+				"X-Ratelimit-Remaining-Tokens":   "0",
+				"X-Ratelimit-Reset-Tokens":       "20ms",
+			},
+			want:   1500 * time.Millisecond,
+			wantOK: true,
+		},
+		{
+			name: "not exhausted",
+			headers: map[string]string{
+				"X-Ratelimit-Remaining-Requests": "10",
+				"X-Ratelimit-Reset-Requests":     "1s",
+			},
+			want:   0,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			got, ok := retryAfter(h, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// apiError returns the error of a response with the given status and no headers.
+func apiError(status int) *goopenai.Error {
+	return &goopenai.Error{
+		StatusCode: status,
+		Request:    httptest.NewRequest(http.MethodPost, "/chat/completions", nil),
+		Response:   &http.Response{StatusCode: status, Header: http.Header{}},
+	}
+}
+
+// rateLimitedFor returns a 429 error whose response has the given header,
+// and no remaining tokens for the x-ratelimit-reset-* headers.
+func rateLimitedFor(key, value string) *goopenai.Error {
+	err := apiError(http.StatusTooManyRequests)
+	err.Response.Header.Set(key, value)
+	err.Response.Header.Set("X-Ratelimit-Remaining-Tokens", "0")
+	return err
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	rateLimited := apiError(http.StatusTooManyRequests)
+	policy := (&RetryPolicy{BaseBackoff: time.Second, MaxBackoff: 3 * time.Second}).withDefaults()
+	tests := []struct {
+		name    string
+		policy  *RetryPolicy
+		attempt int
+		err     error
+		want    time.Duration
+		wantOK  bool
+	}{
+		{name: "first retry", policy: policy, attempt: 1, err: rateLimited, want: time.Second, wantOK: true},
+		{name: "second retry", policy: policy, attempt: 2, err: apiError(http.StatusBadGateway), want: 2 * time.Second, wantOK: true},
+		{name: "max backoff", policy: &RetryPolicy{MaxAttempts: 10, BaseBackoff: time.Second, MaxBackoff: 3 * time.Second, RetryOn: policy.RetryOn}, attempt: 5, err: rateLimited, want: 3 * time.Second, wantOK: true},
+		{name: "attempts exhausted", policy: policy, attempt: 3, err: rateLimited, want: 0, wantOK: false},
+		{name: "bad request", policy: policy, attempt: 1, err: apiError(http.StatusBadRequest), want: 0, wantOK: false},
+		{name: "class not retried", policy: (&RetryPolicy{RetryOn: []ErrorClass{RetryServerError}}).withDefaults(), attempt: 1, err: rateLimited, want: 0, wantOK: false},
+		{name: "other error", policy: policy, attempt: 1, err: errors.New("invalid request"), want: 0, wantOK: false},
+		{name: "requested delay", policy: policy, attempt: 1, err: rateLimitedFor("Retry-After", "2"), want: 2 * time.Second, wantOK: true},
+		{name: "requested delay over max backoff", policy: policy, attempt: 1, err: rateLimitedFor("Retry-After", "4"), want: 0, wantOK: false},
+		{name: "rate limit reset over max backoff", policy: policy, attempt: 1, err: rateLimitedFor("X-Ratelimit-Reset-Tokens", "6m0s"), want: 0, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.policy.delay(context.Background(), tt.attempt, tt.err)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("delay() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, ok := policy.delay(ctx, 1, rateLimited); ok {
+		t.Error("delay() retries after the deadline of the context")
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := &RetryPolicy{BaseBackoff: time.Millisecond}
+	var calls int
+	err := policy.do(context.Background(), func(context.Context) error {
+		calls++
+		return &permanentError{apiError(http.StatusServiceUnavailable)}
+	})
+	var apiErr *goopenai.Error
+	if !errors.As(err, &apiErr) {
+		t.Errorf("do() error = %v, want a *goopenai.Error", err)
+	}
+	if calls != 1 {
+		t.Errorf("a permanent error was attempted %d times, want 1", calls)
+	}
+
+	calls = 0
+	err = policy.do(context.Background(), func(context.Context) error {
+		calls++
+		return apiError(http.StatusServiceUnavailable)
+	})
+	if !errors.As(err, &apiErr) {
+		t.Errorf("do() error = %v, want a *goopenai.Error", err)
+	}
+	if calls != 3 {
+		t.Errorf("a server error was attempted %d times, want 3", calls)
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	for _, r := range []*RetryPolicy{nil, {}, {Jitter: 1, RetryOn: []ErrorClass{RetryRateLimit}}} {
+		if err := r.validate(); err != nil {
+			t.Errorf("%+v.validate() error = %v", r, err)
+		}
+	}
+	for _, r := range []*RetryPolicy{{Jitter: 1.5}, {RetryOn: []ErrorClass{"unknown"}}} {
+		if err := r.validate(); err == nil {
+			t.Errorf("%+v.validate() expected an error", r)
+		}
+	}
+}
+
+func TestModelRetry(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	core.RegisterSpanProcessor(recorder)
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After-Ms", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error": {"message": "Rate limit reached", "type": "requests", "code": "rate_limit_exceeded"}}`)
+		case 2:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error": {"message": "The server had an error", "type": "server_error"}}`)
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: "+`{"id": "chatcmpl-1", "object": "chat.completion.chunk", "created": 1, "model": "gpt-4o-mini", "choices": [{"index": 0, "delta": {"role": "assistant", "content": "Hi"}, "finish_reason": "stop"}]}`+"\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}
+	}))
+	defer srv.Close()
+
+	p := &Plugin{
+		provider: "test-retry",
+		client: goopenai.NewClient(
+			option.WithAPIKey("test"),
+			option.WithBaseURL(srv.URL),
+		),
+		retry: &RetryPolicy{MaxAttempts: 1},
+		modelRetry: map[string]*RetryPolicy{
+			"gpt-4o-mini": {BaseBackoff: time.Millisecond},
+		},
+	}
+	p.mu.Lock()
+	m := p.defineModel("gpt-4o-mini", testModelInfo("gpt-4o-mini"))
+	p.mu.Unlock()
+
+	var chunks int
+	resp, err := m.Generate(context.Background(), &ai.GenerateRequest{
+		Messages: []*ai.Message{ai.NewUserTextMessage("Hello")},
+	}, func(context.Context, *ai.GenerateResponseChunk) error {
+		chunks++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Candidates[0].Message.Content[0].Text; got != "Hi" {
+		t.Errorf("response text = %q, want %q", got, "Hi")
+	}
+	if requests != 3 || chunks != 1 {
+		t.Errorf("got %d requests and %d chunks, want 3 and 1", requests, chunks)
+	}
+
+	var statuses []int64
+	for _, span := range recorder.Ended() {
+		for _, ev := range span.Events() {
+			if ev.Name != "openai.attempt" {
+				continue
+			}
+			status := int64(0)
+			for _, attr := range ev.Attributes {
+				if attr.Key == attribute.Key("status") {
+					status = attr.Value.AsInt64()
+				}
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	if want := []int64{http.StatusTooManyRequests, http.StatusInternalServerError, 0}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("attempt statuses = %v, want %v", statuses, want)
+	}
+}
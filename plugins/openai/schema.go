@@ -0,0 +1,304 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+)
+
+// strictSchemaKeywords are the JSON schema keywords supported by OpenAI's strict mode.
+// See https://platform.openai.com/docs/guides/structured-outputs/supported-schemas
+var strictSchemaKeywords = []string{
+	"type",
+	"properties",
+	"required",
+	"additionalProperties",
+	"items",
+	"enum",
+	"const",
+	"anyOf",
+	"$ref",
+	"$defs",
+	"definitions",
+	"description",
+	"title",
+}
+
+// droppedSchemaKeywords are the JSON schema keywords that are not supported by OpenAI's strict mode,
+// but only annotate or constrain values and can therefore be dropped safely.
+// The generated output is still validated against the original schema by Genkit.
+var droppedSchemaKeywords = []string{
+	"$schema",
+	"$id",
+	"$comment",
+	"default",
+	"examples",
+	"deprecated",
+	"readOnly",
+	"writeOnly",
+	"format",
+	"pattern",
+	"minLength",
+	"maxLength",
+	"minimum",
+	"maximum",
+	"exclusiveMinimum",
+	"exclusiveMaximum",
+	"multipleOf",
+	"minItems",
+	"maxItems",
+	"uniqueItems",
+	"minProperties",
+	"maxProperties",
+	"contentEncoding",
+	"contentMediaType",
+}
+
+// schemaNameRegexp matches the names accepted for a json_schema response format.
+var schemaNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// strictSchema returns a copy of the given JSON schema converted into the subset supported by OpenAI's strict mode:
+// every property is required, additional properties are not allowed, and unsupported keywords are removed.
+// If nullableOptional is true, properties that were optional are made nullable so that the model can omit a value.
+// It returns an error if the schema cannot be represented in strict mode.
+func strictSchema(schema map[string]any, nullableOptional bool) (map[string]any, error) {
+	if _, ok := schema["$ref"]; ok {
+		// The root schema must be an object, so inline the referenced definition.
+		inlined := maps.Clone(resolveSchemaRef(schema, schema))
+		for k, v := range schema {
+			if k != "$ref" {
+				inlined[k] = v
+			}
+		}
+		schema = inlined
+	}
+	if !hasType(schema, "object") {
+		return nil, errors.New("the root schema must be an object")
+	}
+	return convertStrictSchema(schema, "#", nullableOptional)
+}
+
+func convertStrictSchema(schema map[string]any, path string, nullableOptional bool) (map[string]any, error) {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch {
+		case k == "properties", k == "$defs", k == "definitions":
+			schemas, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/%s: must be an object", path, k)
+			}
+			converted := make(map[string]any, len(schemas))
+			for name, s := range schemas {
+				sm, ok := s.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%s/%s/%s: must be a schema object", path, k, name)
+				}
+				c, err := convertStrictSchema(sm, path+"/"+k+"/"+name, nullableOptional)
+				if err != nil {
+					return nil, err
+				}
+				converted[name] = c
+			}
+			out[k] = converted
+		case k == "items":
+			sm, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/items: tuple schemas are not supported", path)
+			}
+			c, err := convertStrictSchema(sm, path+"/items", nullableOptional)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = c
+		case k == "anyOf":
+			schemas, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/anyOf: must be an array", path)
+			}
+			converted := make([]any, len(schemas))
+			for i, s := range schemas {
+				sm, ok := s.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%s/anyOf/%d: must be a schema object", path, i)
+				}
+				c, err := convertStrictSchema(sm, fmt.Sprintf("%s/anyOf/%d", path, i), nullableOptional)
+				if err != nil {
+					return nil, err
+				}
+				converted[i] = c
+			}
+			out[k] = converted
+		case k == "additionalProperties":
+			if b, ok := v.(bool); !ok || b {
+				return nil, fmt.Errorf("%s: objects with additional properties (e.g. maps) are not supported", path)
+			}
+		case k == "required":
+			// required is recomputed below, since every property must be required.
+		case slices.Contains(strictSchemaKeywords, k):
+			out[k] = v
+		case slices.Contains(droppedSchemaKeywords, k):
+			continue
+		default:
+			return nil, fmt.Errorf("%s: keyword %q is not supported", path, k)
+		}
+	}
+
+	_, hasRef := out["$ref"]
+	_, hasAnyOf := out["anyOf"]
+	_, hasEnum := out["enum"]
+	_, hasConst := out["const"]
+	if _, ok := out["type"]; !ok && !hasRef && !hasAnyOf && !hasEnum && !hasConst {
+		return nil, fmt.Errorf("%s: schema must declare a type", path)
+	}
+
+	if hasType(out, "object") {
+		props, _ := out["properties"].(map[string]any)
+		if props == nil {
+			props = map[string]any{}
+			out["properties"] = props
+		}
+		originalRequired := schemaRequired(schema)
+		required := make([]string, 0, len(props))
+		for name, p := range props {
+			if nullableOptional && !slices.Contains(originalRequired, name) {
+				props[name] = nullableSchema(p.(map[string]any))
+			}
+			required = append(required, name)
+		}
+		sort.Strings(required)
+		out["required"] = required
+		out["additionalProperties"] = false
+	}
+	return out, nil
+}
+
+// nullableSchema returns the schema modified to also accept null.
+func nullableSchema(schema map[string]any) map[string]any {
+	switch t := schema["type"].(type) {
+	case string:
+		if t == "null" {
+			return schema
+		}
+		schema["type"] = []any{t, "null"}
+		nullableEnum(schema)
+		return schema
+	case []any:
+		if !slices.Contains(t, any("null")) {
+			schema["type"] = append(slices.Clip(t), "null")
+		}
+		nullableEnum(schema)
+		return schema
+	case []string:
+		if !slices.Contains(t, "null") {
+			schema["type"] = append(slices.Clip(t), "null")
+		}
+		nullableEnum(schema)
+		return schema
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		schema["anyOf"] = append(slices.Clip(anyOf), map[string]any{"type": "null"})
+		return schema
+	}
+	return map[string]any{
+		"anyOf": []any{schema, map[string]any{"type": "null"}},
+	}
+}
+
+// nullableEnum adds null to the enum of the schema, if any, since null would not match it otherwise.
+func nullableEnum(schema map[string]any) {
+	switch enum := schema["enum"].(type) {
+	case []any:
+		if !slices.Contains(enum, nil) {
+			schema["enum"] = append(slices.Clip(enum), nil)
+		}
+	case []string:
+		values := make([]any, 0, len(enum)+1)
+		for _, v := range enum {
+			values = append(values, v)
+		}
+		schema["enum"] = append(values, nil)
+	}
+}
+
+// schemaRequired returns the names of the required properties of the schema.
+func schemaRequired(schema map[string]any) []string {
+	switch r := schema["required"].(type) {
+	case []string:
+		return r
+	case []any:
+		required := make([]string, 0, len(r))
+		for _, name := range r {
+			if s, ok := name.(string); ok {
+				required = append(required, s)
+			}
+		}
+		return required
+	default:
+		return nil
+	}
+}
+
+// resolveSchemaRef returns the definition referenced by the schema's $ref in the root schema.
+// It returns the schema itself if it has no local reference.
+func resolveSchemaRef(schema, root map[string]any) map[string]any {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema
+	}
+	for _, key := range []string{"$defs", "definitions"} {
+		name, ok := strings.CutPrefix(ref, "#/"+key+"/")
+		if !ok {
+			continue
+		}
+		defs, _ := root[key].(map[string]any)
+		if def, ok := defs[name].(map[string]any); ok {
+			return def
+		}
+	}
+	return schema
+}
+
+// inferJSONSchema infers the JSON schema of a value in the same way as Genkit does for action inputs.
+func inferJSONSchema(x any) (map[string]any, error) {
+	r := jsonschema.Reflector{}
+	s := r.Reflect(x)
+	s.Version = ""
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schema: %w", err)
+	}
+	return m, nil
+}
+
+// hasType reports whether the schema declares the given type.
+func hasType(schema map[string]any, typ string) bool {
+	switch t := schema["type"].(type) {
+	case string:
+		return t == typ
+	case []string:
+		return slices.Contains(t, typ)
+	case []any:
+		return slices.Contains(t, any(typ))
+	default:
+		return false
+	}
+}
+
+// schemaName returns the name of a json_schema response format for the given schema.
+func schemaName(schema map[string]any) string {
+	if title, ok := schema["title"].(string); ok && schemaNameRegexp.MatchString(title) {
+		return title
+	}
+	return "output"
+}
@@ -0,0 +1,195 @@
+package openai
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStrictSchema(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]any
+		want  map[string]any
+	}{
+		{
+			name: "optional properties become required",
+			input: map[string]any{
+				"$schema": "http://json-schema.org/draft-07/schema#",
+				"type":    "object",
+				"properties": map[string]any{
+					"name": map[string]any{"type": "string"},
+					"age":  map[string]any{"type": "integer"},
+				},
+				"required": []any{"name"},
+			},
+			want: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{"type": "string"},
+					"age":  map[string]any{"type": "integer"},
+				},
+				"required":             []string{"age", "name"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			name: "nested objects and arrays",
+			input: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"tags": map[string]any{
+						"type":     "array",
+						"minItems": 1,
+						"items": map[string]any{
+							"type":      "string",
+							"maxLength": 10,
+						},
+					},
+					"address": map[string]any{
+						"type":        "object",
+						"description": "postal address",
+						"properties": map[string]any{
+							"city": map[string]any{"type": "string", "format": "city"},
+						},
+					},
+				},
+			},
+			want: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"tags": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "string",
+						},
+					},
+					"address": map[string]any{
+						"type":        "object",
+						"description": "postal address",
+						"properties": map[string]any{
+							"city": map[string]any{"type": "string"},
+						},
+						"required":             []string{"city"},
+						"additionalProperties": false,
+					},
+				},
+				"required":             []string{"address", "tags"},
+				"additionalProperties": false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := strictSchema(tt.input, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("strictSchema() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrictSchemaError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]any
+	}{
+		{
+			name:  "root is not an object",
+			input: map[string]any{"type": "string"},
+		},
+		{
+			name: "map",
+			input: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"labels": map[string]any{
+						"type":                 "object",
+						"additionalProperties": map[string]any{"type": "string"},
+					},
+				},
+			},
+		},
+		{
+			name: "unsupported keyword",
+			input: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"value": map[string]any{
+						"oneOf": []any{
+							map[string]any{"type": "string"},
+							map[string]any{"type": "integer"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "untyped property",
+			input: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"value": map[string]any{},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := strictSchema(tt.input, false); err == nil {
+				t.Error("strictSchema() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestNullableSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema map[string]any
+		want   map[string]any
+	}{
+		{
+			name:   "type",
+			schema: map[string]any{"type": "string"},
+			want:   map[string]any{"type": []any{"string", "null"}},
+		},
+		{
+			name:   "enum",
+			schema: map[string]any{"type": "string", "enum": []any{"c", "f"}},
+			want:   map[string]any{"type": []any{"string", "null"}, "enum": []any{"c", "f", nil}},
+		},
+		{
+			name:   "enum with type array",
+			schema: map[string]any{"type": []any{"string", "integer"}, "enum": []any{"c", 1}},
+			want:   map[string]any{"type": []any{"string", "integer", "null"}, "enum": []any{"c", 1, nil}},
+		},
+		{
+			name:   "string enum with type array",
+			schema: map[string]any{"type": []string{"string"}, "enum": []string{"c", "f"}},
+			want:   map[string]any{"type": []string{"string", "null"}, "enum": []any{"c", "f", nil}},
+		},
+		{
+			name:   "nullable enum",
+			schema: map[string]any{"type": []any{"string", "null"}, "enum": []any{"c", nil}},
+			want:   map[string]any{"type": []any{"string", "null"}, "enum": []any{"c", nil}},
+		},
+		{
+			name:   "ref",
+			schema: map[string]any{"$ref": "#/$defs/Owner"},
+			want:   map[string]any{"anyOf": []any{map[string]any{"$ref": "#/$defs/Owner"}, map[string]any{"type": "null"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nullableSchema(tt.schema); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nullableSchema() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
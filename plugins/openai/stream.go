@@ -0,0 +1,131 @@
+package openai
+
+import (
+	"encoding/base64"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+)
+
+// chatCompletionAccumulator merges streamed chunks into a single [goopenai.ChatCompletion],
+// so that the final response can be translated in the same way as a non-streaming one.
+type chatCompletionAccumulator struct {
+	goopenai.ChatCompletion
+	// audio holds the audio generated for each choice, keyed by choice index.
+	// It is not part of goopenai.ChatCompletion, so it is accumulated separately.
+	audio map[int64]*streamedAudio
+}
+
+// streamedAudio is the audio accumulated from streamed fragments.
+type streamedAudio struct {
+	audioOutput
+	// data is the decoded audio. Each fragment is encoded separately, so the base64 strings cannot be joined.
+	data []byte
+}
+
+// addChunk merges the chunk into the accumulated completion.
+func (acc *chatCompletionAccumulator) addChunk(chunk goopenai.ChatCompletionChunk) {
+	acc.ID = chunk.ID
+	acc.Created = chunk.Created
+	acc.Model = chunk.Model
+	acc.Object = goopenai.ChatCompletionObjectChatCompletion
+	acc.ServiceTier = goopenai.ChatCompletionServiceTier(chunk.ServiceTier)
+	if chunk.SystemFingerprint != "" {
+		acc.SystemFingerprint = chunk.SystemFingerprint
+	}
+	// NOTE: Usage is only sent in the last chunk when stream_options.include_usage is set.
+	if chunk.Usage.TotalTokens > 0 {
+		acc.Usage = chunk.Usage
+	}
+
+	for _, c := range chunk.Choices {
+		choice := acc.choice(c.Index)
+		choice.Message.Role = goopenai.ChatCompletionMessageRoleAssistant
+		choice.Message.Content += c.Delta.Content
+		choice.Message.Refusal += c.Delta.Refusal
+		choice.Logprobs.Content = append(choice.Logprobs.Content, c.Logprobs.Content...)
+		choice.Logprobs.Refusal = append(choice.Logprobs.Refusal, c.Logprobs.Refusal...)
+		for _, tc := range c.Delta.ToolCalls {
+			addToolCallDelta(choice, tc)
+		}
+		if audio := deltaAudio(c.Delta); audio != nil {
+			acc.addAudioDelta(c.Index, audio)
+		}
+		if c.FinishReason != "" {
+			choice.FinishReason = goopenai.ChatCompletionChoicesFinishReason(c.FinishReason)
+		}
+	}
+}
+
+// choice returns the accumulated choice with the given index, adding it if necessary.
+func (acc *chatCompletionAccumulator) choice(index int64) *goopenai.ChatCompletionChoice {
+	for i := range acc.Choices {
+		if acc.Choices[i].Index == index {
+			return &acc.Choices[i]
+		}
+	}
+	acc.Choices = append(acc.Choices, goopenai.ChatCompletionChoice{Index: index})
+	return &acc.Choices[len(acc.Choices)-1]
+}
+
+// addToolCallDelta merges a tool call fragment into the choice.
+// Fragments are keyed by their index, so parallel tool calls in one turn are kept apart.
+func addToolCallDelta(choice *goopenai.ChatCompletionChoice, delta goopenai.ChatCompletionChunkChoicesDeltaToolCall) {
+	for int64(len(choice.Message.ToolCalls)) <= delta.Index {
+		choice.Message.ToolCalls = append(choice.Message.ToolCalls, goopenai.ChatCompletionMessageToolCall{})
+	}
+	toolCall := &choice.Message.ToolCalls[delta.Index]
+	if delta.ID != "" {
+		toolCall.ID = delta.ID
+	}
+	if delta.Type != "" {
+		toolCall.Type = goopenai.ChatCompletionMessageToolCallType(delta.Type)
+	}
+	toolCall.Function.Name += delta.Function.Name
+	toolCall.Function.Arguments += delta.Function.Arguments
+}
+
+// addAudioDelta merges an audio fragment into the audio of the choice with the given index.
+func (acc *chatCompletionAccumulator) addAudioDelta(index int64, delta *audioOutput) {
+	if acc.audio == nil {
+		acc.audio = map[int64]*streamedAudio{}
+	}
+	audio, ok := acc.audio[index]
+	if !ok {
+		audio = &streamedAudio{}
+		acc.audio[index] = audio
+	}
+	if delta.ID != "" {
+		audio.ID = delta.ID
+	}
+	if delta.ExpiresAt != 0 {
+		audio.ExpiresAt = delta.ExpiresAt
+	}
+	if data, err := base64.StdEncoding.DecodeString(delta.Data); err == nil {
+		audio.data = append(audio.data, data...)
+	}
+	audio.Transcript += delta.Transcript
+}
+
+// choiceAudio returns the audio accumulated for the choice with the given index, or nil if there is none.
+func (acc *chatCompletionAccumulator) choiceAudio(index int64) *audioOutput {
+	audio, ok := acc.audio[index]
+	if !ok {
+		return nil
+	}
+	out := audio.audioOutput
+	out.Data = base64.StdEncoding.EncodeToString(audio.data)
+	return &out
+}
+
+// toolRequestParts returns the tool requests accumulated for the choice with the given index.
+// It should only be called once the choice is finished, since arguments are incomplete until then.
+// Tool calls with malformed arguments are sent as text, see [MalformedToolCallsKey].
+func (acc *chatCompletionAccumulator) toolRequestParts(index int64) []*ai.Part {
+	calls := acc.choice(index).Message.ToolCalls
+	parts, ok := translateToolCalls(calls)
+	if !ok {
+		return malformedToolCallParts(toolCalls(calls))
+	}
+	return parts
+}
@@ -0,0 +1,259 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// newStreamingTestClient returns a client talking to a server that streams the given chunks as server-sent events.
+func newStreamingTestClient(t *testing.T, chunks []string) *goopenai.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return goopenai.NewClient(
+		option.WithAPIKey("test"),
+		option.WithBaseURL(srv.URL),
+		option.WithMaxRetries(0),
+	)
+}
+
+func TestGenerateStream(t *testing.T) {
+	client := newStreamingTestClient(t, []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":", world"},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`,
+	})
+
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewTextPart("Say hello.")},
+			},
+		},
+	}
+
+	var streamed []string
+	cb := func(ctx context.Context, chunk *ai.GenerateResponseChunk) error {
+		for _, p := range chunk.Content {
+			streamed = append(streamed, p.Text)
+		}
+		return nil
+	}
+
+	got, err := (&Plugin{client: client}).generate(context.Background(), goopenai.ChatModelGPT4oMini, testModelInfo(goopenai.ChatModelGPT4oMini), input, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"Hello", ", world"}; !reflect.DeepEqual(streamed, want) {
+		t.Errorf("streamed chunks = %q, want %q", streamed, want)
+	}
+	if got.Request != input {
+		t.Error("Request field not set properly")
+	}
+	if len(got.Candidates) != 1 {
+		t.Fatalf("got %d candidates, want 1", len(got.Candidates))
+	}
+	wantCandidate := &ai.Candidate{
+		Index:        0,
+		FinishReason: ai.FinishReasonStop,
+		Message: &ai.Message{
+			Role:    ai.RoleModel,
+			Content: []*ai.Part{ai.NewTextPart("Hello, world")},
+		},
+	}
+	if !reflect.DeepEqual(got.Candidates[0], wantCandidate) {
+		t.Errorf("candidate = %#v, want %#v", got.Candidates[0], wantCandidate)
+	}
+	wantUsage := &ai.GenerationUsage{
+		InputTokens:      5,
+		OutputTokens:     3,
+		TotalTokens:      8,
+		InputCharacters:  len("Say hello."),
+		OutputCharacters: len("Hello, world"),
+	}
+	if !reflect.DeepEqual(got.Usage, wantUsage) {
+		t.Errorf("usage = %#v, want %#v", got.Usage, wantUsage)
+	}
+	if custom, ok := got.Custom.(*ResponseCustom); !ok || custom.Completion == nil || custom.Completion.Choices[0].Message.Content != "Hello, world" {
+		t.Errorf("response custom = %#v, want the accumulated completion", got.Custom)
+	}
+}
+
+func TestGenerateStreamCallbackError(t *testing.T) {
+	client := newStreamingTestClient(t, []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+	})
+
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewTextPart("Say hello.")},
+			},
+		},
+	}
+
+	cb := func(ctx context.Context, chunk *ai.GenerateResponseChunk) error {
+		return fmt.Errorf("stop streaming")
+	}
+
+	_, err := (&Plugin{client: client}).generate(context.Background(), goopenai.ChatModelGPT4oMini, testModelInfo(goopenai.ChatModelGPT4oMini), input, cb)
+	if err == nil || !strings.Contains(err.Error(), "stop streaming") {
+		t.Errorf("got error %v, want the callback error", err)
+	}
+}
+
+func TestGenerateStreamToolCalls(t *testing.T) {
+	client := newStreamingTestClient(t, []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"role":"assistant","content":null,"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"getWeather","arguments":""}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"getWeather","arguments":"{\"city\":"}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Tokyo\"}"}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	})
+
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewTextPart("What's the weather in Tokyo and Paris?")},
+			},
+		},
+	}
+
+	var streamed []*ai.Part
+	cb := func(ctx context.Context, chunk *ai.GenerateResponseChunk) error {
+		streamed = append(streamed, chunk.Content...)
+		return nil
+	}
+
+	got, err := (&Plugin{client: client}).generate(context.Background(), goopenai.ChatModelGPT4oMini, testModelInfo(goopenai.ChatModelGPT4oMini), input, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*ai.Part{
+		ai.NewToolRequestPart(&ai.ToolRequest{
+			Name:  "getWeather",
+			Input: map[string]any{"city": "Tokyo"},
+		}),
+		ai.NewToolRequestPart(&ai.ToolRequest{
+			Name:  "getWeather",
+			Input: map[string]any{"city": "Paris"},
+		}),
+	}
+	if !reflect.DeepEqual(streamed, want) {
+		t.Errorf("streamed parts = %#v, want %#v", streamed, want)
+	}
+	if len(got.Candidates) != 1 {
+		t.Fatalf("got %d candidates, want 1", len(got.Candidates))
+	}
+	if !reflect.DeepEqual(got.Candidates[0].Message.Content, want) {
+		t.Errorf("candidate content = %#v, want %#v", got.Candidates[0].Message.Content, want)
+	}
+}
+
+func TestGenerateStreamLogprobs(t *testing.T) {
+	client := newStreamingTestClient(t, []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":"Hello"},"logprobs":{"content":[{"token":"Hello","logprob":-0.1,"bytes":[72,101,108,108,111],"top_logprobs":[]}],"refusal":null},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":"!"},"logprobs":{"content":[{"token":"!","logprob":-0.2,"bytes":[33],"top_logprobs":[]}],"refusal":null},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{},"logprobs":null,"finish_reason":"stop"}]}`,
+	})
+
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewTextPart("Say hello.")},
+			},
+		},
+		Config: &GenerationConfig{Logprobs: true},
+	}
+
+	var streamed []any
+	cb := func(ctx context.Context, chunk *ai.GenerateResponseChunk) error {
+		streamed = append(streamed, chunk.Custom)
+		return nil
+	}
+
+	got, err := (&Plugin{client: client}).generate(context.Background(), goopenai.ChatModelGPT4oMini, testModelInfo(goopenai.ChatModelGPT4oMini), input, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hello := TokenLogprob{Token: "Hello", Logprob: -0.1, Bytes: []int64{72, 101, 108, 108, 111}}
+	exclamation := TokenLogprob{Token: "!", Logprob: -0.2, Bytes: []int64{33}}
+	wantStreamed := []any{
+		&CandidateCustom{Logprobs: &Logprobs{Content: []TokenLogprob{hello}}},
+		&CandidateCustom{Logprobs: &Logprobs{Content: []TokenLogprob{exclamation}}},
+	}
+	if !reflect.DeepEqual(streamed, wantStreamed) {
+		t.Errorf("streamed custom = %#v, want %#v", streamed, wantStreamed)
+	}
+	if len(got.Candidates) != 1 {
+		t.Fatalf("got %d candidates, want 1", len(got.Candidates))
+	}
+	wantCustom := &CandidateCustom{Logprobs: &Logprobs{Content: []TokenLogprob{hello, exclamation}}}
+	if !reflect.DeepEqual(got.Candidates[0].Custom, wantCustom) {
+		t.Errorf("candidate custom = %#v, want %#v", got.Candidates[0].Custom, wantCustom)
+	}
+}
+
+func TestGenerateStreamRefusal(t *testing.T) {
+	client := newStreamingTestClient(t, []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"role":"assistant","content":null,"refusal":""},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"refusal":"I'm sorry,"},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{"refusal":" I cannot help."},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o-mini","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	})
+
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleUser,
+				Content: []*ai.Part{ai.NewTextPart("Say hello.")},
+			},
+		},
+	}
+
+	var streamed []string
+	cb := func(ctx context.Context, chunk *ai.GenerateResponseChunk) error {
+		for _, p := range chunk.Content {
+			streamed = append(streamed, p.Text)
+		}
+		return nil
+	}
+
+	got, err := (&Plugin{client: client}).generate(context.Background(), goopenai.ChatModelGPT4oMini, testModelInfo(goopenai.ChatModelGPT4oMini), input, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"I'm sorry,", " I cannot help."}; !reflect.DeepEqual(streamed, want) {
+		t.Errorf("streamed chunks = %q, want %q", streamed, want)
+	}
+	c := got.Candidates[0]
+	if c.FinishReason != ai.FinishReasonBlocked || c.Text() != "I'm sorry, I cannot help." {
+		t.Errorf("candidate = %q (%s), want the refusal", c.Text(), c.FinishReason)
+	}
+}
@@ -0,0 +1,187 @@
+package tokenizer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"sort"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/yukinagae/genkit-go-plugins/plugins/openai/internal/tokencount"
+)
+
+func init() {
+	tokencount.Set(func(encoding string, messages []*ai.Message, tools []*ai.ToolDefinition) (int, error) {
+		e, err := GetEncoding(encoding)
+		if err != nil {
+			return 0, err
+		}
+		return countTokens(e, messages, tools)
+	})
+}
+
+// Token overheads of the chat format, as documented by OpenAI in
+// https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+const (
+	// tokensPerMessage wraps each message.
+	tokensPerMessage = 3
+	// replyTokens primes the reply of the model.
+	replyTokens = 3
+)
+
+// CountTokens returns the number of input tokens of the messages and tool definitions of a request
+// for the model, including the overhead of the chat format.
+// Images are counted from their size and detail; audio is not counted.
+func CountTokens(model string, messages []*ai.Message, tools []*ai.ToolDefinition) (int, error) {
+	e, err := ForModel(model)
+	if err != nil {
+		return 0, err
+	}
+	return countTokens(e, messages, tools)
+}
+
+// countTokens returns the number of input tokens of the messages and tool definitions with the encoding.
+func countTokens(e *Encoding, messages []*ai.Message, tools []*ai.ToolDefinition) (int, error) {
+	n := replyTokens + countToolTokens(e, tools)
+	for _, m := range messages {
+		n += tokensPerMessage + e.Count(role(m.Role))
+		for _, p := range m.Content {
+			switch {
+			case p.IsText(), p.IsData():
+				n += e.Count(p.Text)
+			case p.IsMedia():
+				if strings.HasPrefix(p.ContentType, "image/") || strings.HasPrefix(p.Text, "data:image/") {
+					n += imageTokens(p)
+				}
+			case p.IsToolRequest():
+				args, err := json.Marshal(p.ToolRequest.Input)
+				if err != nil {
+					return 0, fmt.Errorf("tokenizer: %w", err)
+				}
+				n += e.Count(p.ToolRequest.Name) + e.Count(string(args))
+			case p.IsToolResponse():
+				output, err := json.Marshal(p.ToolResponse.Output)
+				if err != nil {
+					return 0, fmt.Errorf("tokenizer: %w", err)
+				}
+				n += e.Count(string(output))
+			}
+		}
+	}
+	return n, nil
+}
+
+// role returns the OpenAI name of the role.
+func role(r ai.Role) string {
+	if r == ai.RoleModel {
+		return "assistant"
+	}
+	return string(r)
+}
+
+// Token overheads of the tool definitions, from the same OpenAI documentation as the chat format.
+const (
+	propertiesTokens = 3
+	propertyTokens   = 3
+	enumTokens       = -3
+	enumItemTokens   = 3
+	toolsEndTokens   = 12
+)
+
+// countToolTokens returns the number of input tokens of the tool definitions with the encoding.
+func countToolTokens(e *Encoding, tools []*ai.ToolDefinition) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	toolTokens := 10
+	if e.Name() == O200kBase {
+		toolTokens = 7
+	}
+	n := toolsEndTokens
+	for _, t := range tools {
+		n += toolTokens + e.Count(t.Name+":"+strings.TrimSuffix(t.Description, "."))
+		properties, _ := t.InputSchema["properties"].(map[string]any)
+		if len(properties) == 0 {
+			continue
+		}
+		n += propertiesTokens
+		keys := make([]string, 0, len(properties))
+		for k := range properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			n += propertyTokens
+			p, _ := properties[k].(map[string]any)
+			if enum, ok := p["enum"].([]any); ok {
+				n += enumTokens
+				for _, item := range enum {
+					n += enumItemTokens + e.Count(fmt.Sprint(item))
+				}
+			}
+			description, _ := p["description"].(string)
+			n += e.Count(fmt.Sprintf("%s:%v:%s", k, p["type"], strings.TrimSuffix(description, ".")))
+		}
+	}
+	return n
+}
+
+// Token counts of images, see https://platform.openai.com/docs/guides/vision/calculating-costs
+const (
+	imageBaseTokens = 85
+	imageTileTokens = 170
+	// defaultImageTokens is the count of an image whose size is unknown, e.g. an image URL.
+	// It is the count of a 1024x1024 image in high detail.
+	defaultImageTokens = imageBaseTokens + 4*imageTileTokens
+)
+
+// imageTokens returns the number of tokens of an image part.
+func imageTokens(p *ai.Part) int {
+	_, params, _ := mime.ParseMediaType(p.ContentType)
+	if params["detail"] == "low" {
+		return imageBaseTokens
+	}
+	_, data, ok := strings.Cut(p.Text, ";base64,")
+	if !ok {
+		return defaultImageTokens
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return defaultImageTokens
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return defaultImageTokens
+	}
+	return imageBaseTokens + imageTileTokens*imageTiles(cfg.Width, cfg.Height)
+}
+
+// imageTiles returns the number of 512px tiles of an image processed in high detail.
+// The image is scaled to fit in 2048x2048, then its shortest side is scaled down to 768px.
+func imageTiles(width, height int) int {
+	w, h := float64(width), float64(height)
+	if w > 2048 || h > 2048 {
+		scale := 2048 / max(w, h)
+		w, h = w*scale, h*scale
+	}
+	if min(w, h) > 768 {
+		scale := 768 / min(w, h)
+		w, h = w*scale, h*scale
+	}
+	return ceilDiv(w, 512) * ceilDiv(h, 512)
+}
+
+func ceilDiv(x, d float64) int {
+	n := int(x / d)
+	if float64(n)*d < x {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,160 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// useEncoding makes e the loaded encoding with its name for the duration of the test.
+func useEncoding(t *testing.T, e *Encoding) {
+	t.Helper()
+	encodings.mu.Lock()
+	defer encodings.mu.Unlock()
+	if encodings.loaded == nil {
+		encodings.loaded = map[string]*Encoding{}
+	}
+	old, ok := encodings.loaded[e.name]
+	encodings.loaded[e.name] = e
+	t.Cleanup(func() {
+		encodings.mu.Lock()
+		defer encodings.mu.Unlock()
+		if ok {
+			encodings.loaded[e.name] = old
+		} else {
+			delete(encodings.loaded, e.name)
+		}
+	})
+}
+
+func TestCountTokens(t *testing.T) {
+	// Every byte is a token.
+	useEncoding(t, testEncoding(t, Cl100kBase))
+
+	got, err := CountTokens("gpt-4", []*ai.Message{
+		ai.NewSystemTextMessage("abc"),
+		ai.NewUserTextMessage("hello"),
+		ai.NewModelMessage(ai.NewToolRequestPart(&ai.ToolRequest{Name: "f", Input: map[string]any{"a": 1}})),
+		{Role: ai.RoleTool, Content: []*ai.Part{ai.NewToolResponsePart(&ai.ToolResponse{Name: "f", Output: map[string]any{"b": 2}})}},
+		ai.NewUserMessage(ai.NewMediaPart("image/png; detail=low", "https://example.com/a.png")),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := replyTokens +
+		tokensPerMessage + len("system") + len("abc") +
+		tokensPerMessage + len("user") + len("hello") +
+		tokensPerMessage + len("assistant") + len("f") + len(`{"a":1}`) +
+		tokensPerMessage + len("tool") + len(`{"b":2}`) +
+		tokensPerMessage + len("user") + imageBaseTokens
+	if got != want {
+		t.Errorf("CountTokens() = %d, want %d", got, want)
+	}
+
+	if _, err := CountTokens("unknown-model", nil, nil); err == nil {
+		t.Error("CountTokens() expected an error for an unknown model")
+	}
+}
+
+func TestCountTokensWithTools(t *testing.T) {
+	// Every byte is a token.
+	useEncoding(t, testEncoding(t, Cl100kBase))
+
+	tools := []*ai.ToolDefinition{{
+		Name:        "weather",
+		Description: "Get the weather.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"city": map[string]any{"type": "string", "description": "The city."},
+				"unit": map[string]any{"type": "string", "enum": []any{"c", "f"}},
+			},
+		},
+	}}
+	msgs := []*ai.Message{ai.NewUserTextMessage("hello")}
+	got, err := CountTokens("gpt-4", msgs, tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := replyTokens + tokensPerMessage + len("user") + len("hello") +
+		toolsEndTokens + 10 + len("weather:Get the weather") +
+		propertiesTokens +
+		propertyTokens + len("city:string:The city") +
+		propertyTokens + enumTokens + 2*(enumItemTokens+1) + len("unit:string:")
+	if got != want {
+		t.Errorf("CountTokens() = %d, want %d", got, want)
+	}
+}
+
+func TestImageTiles(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          int
+	}{
+		{width: 512, height: 512, want: 1},
+		{width: 1024, height: 1024, want: 4},
+		{width: 2048, height: 4096, want: 6},
+		{width: 100, height: 1000, want: 2},
+	}
+
+	for _, tt := range tests {
+		if got := imageTiles(tt.width, tt.height); got != tt.want {
+			t.Errorf("imageTiles(%d, %d) = %d, want %d", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+
+// TestReferenceCountTokens checks the count of chat requests with the embedded encodings against
+// the prompt tokens reported by OpenAI, and the formulas of the OpenAI cookbook computed with tiktoken.
+func TestReferenceCountTokens(t *testing.T) {
+	chat := []*ai.Message{
+		ai.NewSystemTextMessage("You are a helpful assistant."),
+		ai.NewUserTextMessage("What's the weather in Tokyo?"),
+		ai.NewModelMessage(ai.NewToolRequestPart(&ai.ToolRequest{Name: "weather", Input: map[string]any{"city": "Tokyo"}})),
+		{Role: ai.RoleTool, Content: []*ai.Part{ai.NewToolResponsePart(&ai.ToolResponse{
+			Name:   "weather",
+			Output: map[string]any{"forecast": "sunny", "temperature": 21},
+		})}},
+		ai.NewModelTextMessage("It's sunny and 21°C in Tokyo."),
+	}
+	tools := []*ai.ToolDefinition{
+		{
+			Name:        "weather",
+			Description: "Get the current weather of a city.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"city": map[string]any{"type": "string", "description": "The name of the city."},
+					"unit": map[string]any{"type": "string", "enum": []any{"celsius", "fahrenheit"}},
+				},
+			},
+		},
+		{Name: "time", Description: "Get the local time."},
+	}
+
+	tests := []struct {
+		name     string
+		model    string
+		messages []*ai.Message
+		tools    []*ai.ToolDefinition
+		want     int
+	}{
+		{name: "hello world", model: "gpt-4", messages: []*ai.Message{ai.NewUserTextMessage("hello world")}, want: 9},
+		{name: "chat", model: "gpt-4", messages: chat, want: 63},
+		{name: "chat with tools", model: "gpt-4", messages: chat, tools: tools, want: 134},
+		{name: "chat", model: "gpt-4o", messages: chat, want: 60},
+		{name: "chat with tools", model: "gpt-4o", messages: chat, tools: tools, want: 125},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model+" "+tt.name, func(t *testing.T) {
+			got, err := CountTokens(tt.model, tt.messages, tt.tools)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CountTokens() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+//go:build ignore
+
+// gen_ranks downloads the ranks of the encodings published by OpenAI into the ranks directory.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// files maps the rank files to their URL and SHA-256 hash, as given by tiktoken.
+var files = map[string]struct{ url, hash string }{
+	"cl100k_base.tiktoken": {
+		url:  "https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken",
+		hash: "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+	},
+	"o200k_base.tiktoken": {
+		url:  "https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken",
+		hash: "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+	},
+}
+
+func main() {
+	for name, f := range files {
+		if err := download(filepath.Join("ranks", name), f.url, f.hash); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func download(path, url, hash string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != hash {
+		return fmt.Errorf("%s: hash %s, want %s", url, got, hash)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,127 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yukinagae/genkit-go-plugins/plugins/openai"
+)
+
+//go:generate go run gen_ranks.go
+
+// embeddedRanks holds the rank files of the encodings, ranks/<encoding>.tiktoken,
+// as published by OpenAI. go generate downloads them again and checks their hashes.
+//
+//go:embed ranks
+var embeddedRanks embed.FS
+
+var encodings struct {
+	mu sync.Mutex
+	// loaded holds the encodings, keyed by name.
+	loaded map[string]*Encoding
+}
+
+// GetEncoding returns the encoding with the given name, "cl100k_base" or "o200k_base".
+// The ranks of the encoding are the embedded ones, unless they were given with [LoadRanks].
+func GetEncoding(name string) (*Encoding, error) {
+	encodings.mu.Lock()
+	defer encodings.mu.Unlock()
+	if e, ok := encodings.loaded[name]; ok {
+		return e, nil
+	}
+	if _, ok := patterns[name]; !ok {
+		return nil, fmt.Errorf("tokenizer: unknown encoding %q", name)
+	}
+	f, err := embeddedRanks.Open("ranks/" + name + ".tiktoken")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("tokenizer: the ranks of %q are not embedded: run go generate, or call LoadRanks", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: %w", err)
+	}
+	defer f.Close()
+	return loadRanks(name, f)
+}
+
+// LoadRanks loads the ranks of the named encoding from r, in the format of the .tiktoken files
+// published by OpenAI: one token per line, as its base64 encoded bytes followed by its rank.
+// It replaces the embedded ranks, e.g. to keep them out of the binary.
+func LoadRanks(name string, r io.Reader) error {
+	if _, ok := patterns[name]; !ok {
+		return fmt.Errorf("tokenizer: unknown encoding %q", name)
+	}
+	encodings.mu.Lock()
+	defer encodings.mu.Unlock()
+	_, err := loadRanks(name, r)
+	return err
+}
+
+// requires encodings.mu
+func loadRanks(name string, r io.Reader) (*Encoding, error) {
+	ranks, err := parseRanks(r)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: invalid ranks of %q: %w", name, err)
+	}
+	e := &Encoding{
+		name:    name,
+		pattern: compilePattern(patterns[name]),
+		ranks:   ranks,
+	}
+	if encodings.loaded == nil {
+		encodings.loaded = map[string]*Encoding{}
+	}
+	encodings.loaded[name] = e
+	return e, nil
+}
+
+// parseRanks parses a .tiktoken file.
+// Every byte must be a token, so that any text can be encoded.
+func parseRanks(r io.Reader) (map[string]int, error) {
+	ranks := map[string]int{}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		token, rank, ok := strings.Cut(s.Text(), " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing rank", line)
+		}
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(rank))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ranks[string(b)] = n
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("byte %#x is not a token", b)
+		}
+	}
+	return ranks, nil
+}
+
+// ForModel returns the encoding of the model, as given by [openai.LookupModelInfo].
+func ForModel(model string) (*Encoding, error) {
+	info, ok := openai.LookupModelInfo(model)
+	if !ok || info.Encoding == "" {
+		return nil, fmt.Errorf("tokenizer: unknown encoding for model %q", model)
+	}
+	return GetEncoding(info.Encoding)
+}
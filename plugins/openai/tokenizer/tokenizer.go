@@ -0,0 +1,139 @@
+// Package tokenizer counts the tokens of OpenAI models offline.
+//
+// It implements the byte pair encodings of tiktoken, cl100k_base and o200k_base,
+// and produces the same tokens as tiktoken for ordinary text (special tokens are not recognized).
+// The encoding of a model is given by the model catalog of the openai plugin.
+// Importing the package also makes the truncation of the openai plugin count tokens with it.
+package tokenizer
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Names of the encodings.
+const (
+	Cl100kBase = "cl100k_base"
+	O200kBase  = "o200k_base"
+)
+
+// whitespace is the character class of Unicode white space, which \s matches in tiktoken's patterns.
+// \s only matches ASCII white space in Go.
+const whitespace = `\t\n\v\f\r\x{85}\p{Z}`
+
+// patterns are the regular expressions splitting text into the pieces encoded separately.
+// tiktoken's patterns end with `\s+(?!\S)|\s+`, and Go does not support lookaheads:
+// the alternatives end with `\s+` here, and [Encoding.split] gives back the last white space
+// before a non-space character instead.
+var patterns = map[string]string{
+	Cl100kBase: `(?i:'s|'t|'re|'ve|'m|'ll|'d)` +
+		`|[^\r\n\p{L}\p{N}]?\p{L}+` +
+		`|\p{N}{1,3}` +
+		`| ?[^\s\p{L}\p{N}]+[\r\n]*` +
+		`|\s*[\r\n]+` +
+		`|\s+`,
+	O200kBase: `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}` +
+		`| ?[^\s\p{L}\p{N}]+[\r\n/]*` +
+		`|\s*[\r\n]+` +
+		`|\s+`,
+}
+
+// compilePattern compiles the pattern of an encoding, anchored at the start of the text.
+func compilePattern(pattern string) *regexp.Regexp {
+	pattern = strings.ReplaceAll(pattern, `[^\s`, `[^`+whitespace)
+	pattern = strings.ReplaceAll(pattern, `\s`, `[`+whitespace+`]`)
+	return regexp.MustCompile(`\A(?:` + pattern + `)`)
+}
+
+// Encoding is a byte pair encoding.
+type Encoding struct {
+	name    string
+	pattern *regexp.Regexp
+	// ranks maps the byte sequences of the tokens to their rank, which is the token itself.
+	ranks map[string]int
+}
+
+// Name returns the name of the encoding, e.g. "o200k_base".
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode returns the tokens of the text.
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range e.split(text) {
+		tokens = e.encodePiece(piece, tokens)
+	}
+	return tokens
+}
+
+// Count returns the number of tokens of the text.
+func (e *Encoding) Count(text string) int {
+	return len(e.Encode(text))
+}
+
+// split splits the text into the pieces matched by the pattern of the encoding.
+func (e *Encoding) split(text string) []string {
+	var pieces []string
+	for text != "" {
+		loc := e.pattern.FindStringIndex(text)
+		if loc == nil || loc[1] == 0 {
+			// Every character is matched by the patterns, but make sure the loop ends.
+			_, n := utf8.DecodeRuneInString(text)
+			loc = []int{0, n}
+		}
+		piece := text[:loc[1]]
+		// Emulate `\s+(?!\S)`: a run of white space followed by a non-space character leaves
+		// its last character to the next piece, e.g. "  x" is split into " " and " x".
+		// Runs ending with a line break are matched by `\s*[\r\n]+` instead.
+		if next, _ := utf8.DecodeRuneInString(text[loc[1]:]); loc[1] < len(text) && !unicode.IsSpace(next) &&
+			isSpace(piece) && !strings.HasSuffix(piece, "\n") && !strings.HasSuffix(piece, "\r") {
+			if last, n := utf8.DecodeLastRuneInString(piece); n < len(piece) && unicode.IsSpace(last) {
+				piece = piece[:len(piece)-n]
+			}
+		}
+		pieces = append(pieces, piece)
+		text = text[len(piece):]
+	}
+	return pieces
+}
+
+// isSpace reports whether s only holds white space.
+func isSpace(s string) bool {
+	return strings.TrimFunc(s, unicode.IsSpace) == ""
+}
+
+// encodePiece appends the tokens of a piece of text to tokens.
+// The adjacent parts of the piece with the lowest merged rank are merged until no merge is possible.
+func (e *Encoding) encodePiece(piece string, tokens []int) []int {
+	if rank, ok := e.ranks[piece]; ok {
+		return append(tokens, rank)
+	}
+	// bounds are the start offsets of the parts, followed by the length of the piece.
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		minRank, minIndex := math.MaxInt, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := e.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < minRank {
+				minRank, minIndex = rank, i
+			}
+		}
+		if minIndex < 0 {
+			break
+		}
+		bounds = append(bounds[:minIndex+1], bounds[minIndex+2:]...)
+	}
+	for i := 0; i+1 < len(bounds); i++ {
+		// Every byte is a token, as checked when the ranks are loaded.
+		tokens = append(tokens, e.ranks[piece[bounds[i]:bounds[i+1]]])
+	}
+	return tokens
+}
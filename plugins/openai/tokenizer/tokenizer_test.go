@@ -0,0 +1,186 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRanks returns ranks in the .tiktoken format, with every byte as a token (its rank is the byte)
+// followed by the given merged tokens.
+func testRanks(merged ...string) string {
+	var sb strings.Builder
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	for i, m := range merged {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), 256+i)
+	}
+	return sb.String()
+}
+
+// testEncoding returns an encoding with the pattern of the named encoding and the test ranks.
+func testEncoding(t *testing.T, name string, merged ...string) *Encoding {
+	t.Helper()
+	ranks, err := parseRanks(strings.NewReader(testRanks(merged...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Encoding{name: name, pattern: compilePattern(patterns[name]), ranks: ranks}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     []string
+	}{
+		{Cl100kBase, "hello world", []string{"hello", " world"}},
+		{Cl100kBase, "Hello  world", []string{"Hello", " ", " world"}},
+		{Cl100kBase, "I'm here", []string{"I", "'m", " here"}},
+		{Cl100kBase, "don't", []string{"don", "'t"}},
+		{Cl100kBase, "12345", []string{"123", "45"}},
+		{Cl100kBase, "foo\n\nbar", []string{"foo", "\n\n", "bar"}},
+		{Cl100kBase, "x   \n  y", []string{"x", "   \n", " ", " y"}},
+		{Cl100kBase, "a  ", []string{"a", "  "}},
+		{Cl100kBase, "hello!!! ok", []string{"hello", "!!!", " ok"}},
+		{Cl100kBase, "HelloWorld", []string{"HelloWorld"}},
+		{Cl100kBase, "a　　b", []string{"a", "　", "　b"}},
+		{O200kBase, "HelloWorld", []string{"Hello", "World"}},
+		{O200kBase, "don't", []string{"don't"}},
+		{O200kBase, "path/to\n", []string{"path", "/to", "\n"}},
+		{O200kBase, "x   \n  y", []string{"x", "   \n", " ", " y"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding+" "+tt.text, func(t *testing.T) {
+			e := testEncoding(t, tt.encoding)
+			if got := e.split(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("split(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	e := testEncoding(t, Cl100kBase, "ab", "cd", "abcd", " ab")
+
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{text: "abcd", want: []int{258}},
+		{text: "abcde", want: []int{258, 'e'}},
+		{text: "bcd", want: []int{'b', 257}},
+		{text: "x ab", want: []int{'x', 259}},
+		{text: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := e.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRanksError(t *testing.T) {
+	tests := []struct {
+		name  string
+		ranks string
+	}{
+		{name: "missing rank", ranks: "YQ==\n"},
+		{name: "invalid token", ranks: "!!! 1\n"},
+		{name: "invalid rank", ranks: "YQ== one\n"},
+		{name: "missing bytes", ranks: "YQ== 0\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseRanks(strings.NewReader(tt.ranks)); err == nil {
+				t.Error("parseRanks() expected an error")
+			}
+		})
+	}
+}
+
+// TestReferenceTokens checks the tokens of the embedded encodings against tiktoken,
+// including whitespace runs, digits, contractions and non-ASCII text.
+func TestReferenceTokens(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{Cl100kBase, "hello world", []int{15339, 1917}},
+		{Cl100kBase, "tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{Cl100kBase, "a  \t\n\n   b", []int{64, 256, 16176, 256, 293}},
+		{Cl100kBase, "   leading and trailing   ", []int{256, 6522, 323, 28848, 262}},
+		{Cl100kBase, "line one\r\n\r\nline two\n\n\n", []int{1074, 832, 881, 1074, 1403, 1432}},
+		{Cl100kBase, "1234567890", []int{4513, 10961, 16474, 15}},
+		{Cl100kBase, "3.14159 and 2,718,281 or 1e-10", []int{18, 13, 9335, 2946, 323, 220, 17, 11, 21982, 11, 15282, 477, 220, 16, 68, 12, 605}},
+		{Cl100kBase, "I'm sure they'll say we've done what's right, don't you? I'D HAVE IT.", []int{40, 2846, 2771, 814, 3358, 2019, 584, 3077, 2884, 1148, 596, 1314, 11, 1541, 956, 499, 30, 358, 28805, 19102, 8871, 13}},
+		{Cl100kBase, "こんにちは世界", []int{90115, 3574, 244, 98220}},
+		{Cl100kBase, "東京は晴れです。明日は雨でしょう。", []int{14276, 109, 47653, 15682, 45114, 112, 33121, 38641, 1811, 31958, 9080, 15682, 25132, 101, 16556, 15024, 3484, 229, 30297, 1811}},
+		{Cl100kBase, "Café naïve résumé Größe", []int{34, 2642, 978, 95980, 588, 9517, 1264, 978, 2895, 80040}},
+		{Cl100kBase, "안녕하세요 👋🌍", []int{31495, 230, 75265, 243, 92245, 62904, 233, 9468, 234, 235}},
+		{Cl100kBase, "Привет, мир!", []int{54745, 28089, 8341, 11, 11562, 78746, 0}},
+		{O200kBase, "hello world", []int{24912, 2375}},
+		{O200kBase, "tiktoken is great!", []int{83, 8251, 2488, 382, 2212, 0}},
+		{O200kBase, "a  \t\n\n   b", []int{64, 256, 31711, 256, 287}},
+		{O200kBase, "   leading and trailing   ", []int{256, 8117, 326, 57985, 271}},
+		{O200kBase, "line one\r\n\r\nline two\n\n\n", []int{1137, 1001, 1414, 1137, 1920, 2499}},
+		{O200kBase, "1234567890", []int{7633, 19354, 29338, 15}},
+		{O200kBase, "3.14159 and 2,718,281 or 1e-10", []int{18, 13, 16926, 4621, 326, 220, 17, 11, 41466, 11, 28637, 503, 220, 16, 68, 12, 702}},
+		{O200kBase, "I'm sure they'll say we've done what's right, don't you? I'D HAVE IT.", []int{15390, 3239, 57956, 2891, 24716, 4167, 29400, 1849, 11, 4128, 481, 30, 3413, 35, 35331, 8734, 13}},
+		{O200kBase, "こんにちは世界", []int{95839, 28428}},
+		{O200kBase, "東京は晴れです。明日は雨でしょう。", []int{108713, 5205, 123139, 9472, 15121, 788, 11071, 179657, 53307, 157351, 788}},
+		{O200kBase, "Café naïve résumé Größe", []int{34, 103112, 153475, 737, 140184, 74095}},
+		{O200kBase, "안녕하세요 👋🌍", []int{14307, 171731, 61138, 233, 64364, 235}},
+		{O200kBase, "Привет, мир!", []int{23881, 131903, 11, 37934, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding+" "+tt.text, func(t *testing.T) {
+			e, err := GetEncoding(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// longText is a multi-paragraph text mixing prose, code, punctuation and non-ASCII text.
+const longText = "The quick brown fox jumps over the lazy dog. Meanwhile, 42 developers were debugging a race condition in the scheduler, which had been failing intermittently since version 3.2.1.\n\n" +
+	"\"Don't touch that,\" she said. \"It's been running for 17 hours and we're almost done.\" He couldn't resist; the button was right there.\n\n" +
+	"func main() {\n\tfmt.Println(\"hello, 世界\")\n\tfor i := 0; i < 10; i++ {\n\t\tsum += i * i\n\t}\n}\n\n" +
+	"Résumé: 2019–2024 — Senior Engineer @ ACME Corp.  Skills: Go, Rust, Python; Kubernetes & Terraform.   Languages: English, 日本語, Français."
+
+// TestReferenceLongText checks the number of tokens of a long text against tiktoken.
+func TestReferenceLongText(t *testing.T) {
+	tests := []struct {
+		encoding string
+		want     int
+	}{
+		{Cl100kBase, 156},
+		{O200kBase, 144},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			e, err := GetEncoding(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.Count(longText); got != tt.want {
+				t.Errorf("Count() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// ToolConfig configures how OpenAI models call a tool.
+type ToolConfig struct {
+	// Strict overrides [Config.StrictTools] for the tool, if not nil.
+	Strict *bool
+}
+
+// DefineTool defines a tool with [ai.DefineTool] and configures how the models of the plugin created by [Init]
+// call it, see [Plugin.ConfigureTool]. If strict mode is enabled for the tool, with cfg or [Config.StrictTools],
+// DefineTool reports an error when the input schema cannot be made strict-compatible,
+// rather than every request using the tool failing later.
+func DefineTool[In, Out any](name, description string, cfg *ToolConfig, fn func(ctx context.Context, input In) (Out, error)) (*ai.ToolDef[In, Out], error) {
+	p := mustDefaultPlugin()
+	var in In
+	inputSchema, err := inferJSONSchema(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s.DefineTool: %w", provider, err)
+	}
+	if err := p.configureTool(name, inputSchema, cfg); err != nil {
+		return nil, fmt.Errorf("%s.DefineTool: %w", provider, err)
+	}
+	return ai.DefineTool(name, description, fn), nil
+}
+
+// ConfigureTool configures how the models of the plugin call the named tool, which must be defined.
+// If strict mode is enabled for the tool, with cfg or [Config.StrictTools], ConfigureTool reports an error
+// when the input schema cannot be made strict-compatible.
+func (p *Plugin) ConfigureTool(name string, cfg *ToolConfig) error {
+	t := ai.LookupTool(name)
+	if t.Action() == nil {
+		return fmt.Errorf("%s.ConfigureTool: unknown tool %q", provider, name)
+	}
+	if err := p.configureTool(name, t.Definition().InputSchema, cfg); err != nil {
+		return fmt.Errorf("%s.ConfigureTool: %w", provider, err)
+	}
+	return nil
+}
+
+func (p *Plugin) configureTool(name string, inputSchema map[string]any, cfg *ToolConfig) error {
+	strict := p.strictTools
+	if cfg != nil && cfg.Strict != nil {
+		strict = *cfg.Strict
+	}
+	if strict {
+		if _, err := strictSchema(inputSchema, true); err != nil {
+			return fmt.Errorf("tool %q cannot be used in strict mode: %w", name, err)
+		}
+	}
+	p.toolsMu.Lock()
+	defer p.toolsMu.Unlock()
+	if cfg == nil || cfg.Strict == nil {
+		delete(p.toolStrict, name)
+		return nil
+	}
+	if p.toolStrict == nil {
+		p.toolStrict = map[string]bool{}
+	}
+	p.toolStrict[name] = *cfg.Strict
+	return nil
+}
+
+// isStrictTool reports whether the named tool is called in strict mode by the models of the plugin.
+func (p *Plugin) isStrictTool(name string) bool {
+	p.toolsMu.Lock()
+	defer p.toolsMu.Unlock()
+	if strict, ok := p.toolStrict[name]; ok {
+		return strict
+	}
+	return p.strictTools
+}
+
+// dropNullOptionalArguments removes the null arguments that strict mode generates for optional fields,
+// so that the tool requests are valid against the original input schema of the tool.
+func dropNullOptionalArguments(parts []*ai.Part, tools []*ai.ToolDefinition, isStrictTool func(name string) bool) {
+	for _, p := range parts {
+		if !p.IsToolRequest() || !isStrictTool(p.ToolRequest.Name) {
+			continue
+		}
+		i := slices.IndexFunc(tools, func(t *ai.ToolDefinition) bool { return t.Name == p.ToolRequest.Name })
+		if i < 0 {
+			continue
+		}
+		dropNullOptionals(p.ToolRequest.Input, tools[i].InputSchema, tools[i].InputSchema)
+	}
+}
+
+func dropNullOptionals(value, schema, root map[string]any) {
+	schema = resolveSchemaRef(schema, root)
+	props, _ := schema["properties"].(map[string]any)
+	required := schemaRequired(schema)
+	for k, v := range value {
+		if v == nil && !slices.Contains(required, k) {
+			delete(value, k)
+			continue
+		}
+		ps, ok := props[k].(map[string]any)
+		if !ok {
+			continue
+		}
+		ps = resolveSchemaRef(ps, root)
+		switch v := v.(type) {
+		case map[string]any:
+			dropNullOptionals(v, ps, root)
+		case []any:
+			items, ok := ps["items"].(map[string]any)
+			if !ok {
+				continue
+			}
+			for _, item := range v {
+				if m, ok := item.(map[string]any); ok {
+					dropNullOptionals(m, items, root)
+				}
+			}
+		}
+	}
+}
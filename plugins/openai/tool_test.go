@@ -0,0 +1,68 @@
+package openai
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDropNullOptionals(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"city":  map[string]any{"type": "string"},
+			"limit": map[string]any{"type": "integer"},
+			"owner": map[string]any{"$ref": "#/$defs/Owner"},
+		},
+		"required": []any{"city", "owner"},
+		"$defs": map[string]any{
+			"Owner": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name":  map[string]any{"type": "string"},
+					"email": map[string]any{"type": "string"},
+				},
+				"required": []any{"name"},
+			},
+		},
+	}
+	got := map[string]any{
+		"city":  "Tokyo",
+		"limit": nil,
+		"owner": map[string]any{
+			"name":  "Bob",
+			"email": nil,
+		},
+	}
+	want := map[string]any{
+		"city": "Tokyo",
+		"owner": map[string]any{
+			"name": "Bob",
+		},
+	}
+
+	dropNullOptionals(got, schema, schema)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dropNullOptionals() = %#v, want %#v", got, want)
+	}
+}
+
+func TestInferJSONSchema(t *testing.T) {
+	type Query struct {
+		City  string `json:"city"`
+		Limit int    `json:"limit,omitempty"`
+	}
+	schema, err := inferJSONSchema(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strictSchema(schema, true); err != nil {
+		t.Errorf("strictSchema() of inferred schema failed: %v", err)
+	}
+	schema, err = inferJSONSchema(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strictSchema(schema, true); err == nil {
+		t.Error("strictSchema() of inferred map schema succeeded, want error")
+	}
+}
@@ -1,27 +1,139 @@
 package openai
 
 import (
+	"fmt"
+
 	"github.com/firebase/genkit/go/ai"
 	goopenai "github.com/openai/openai-go"
 )
 
-func translateResponse(resp *goopenai.ChatCompletion, jsonMode bool) *ai.GenerateResponse {
+// toolCallIDsKey is the message metadata key for the IDs of the tool calls requested by the model.
+const toolCallIDsKey = "toolCallIds"
+
+// MalformedToolCallsKey is the message metadata key for the tool calls requested by the model
+// when the arguments of any of them are not a valid JSON object, e.g. because the output was truncated.
+// The calls are not turned into tool requests, so that the tools are not run with invalid input:
+// the message holds them as text instead, with their raw arguments, so that it can be sent back
+// to ask the model again, and the candidate finishes with [ai.FinishReasonLength] or [ai.FinishReasonOther].
+// Use [MalformedToolCalls] to get the calls, e.g. to repair them.
+const MalformedToolCallsKey = "malformedToolCalls"
+
+// ToolCall is a tool call requested by the model, with its arguments as generated.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// MalformedToolCalls returns the tool calls recorded under [MalformedToolCallsKey] in the metadata of the message.
+func MalformedToolCalls(m *ai.Message) []ToolCall {
+	switch v := m.Metadata[MalformedToolCallsKey].(type) {
+	case []ToolCall:
+		return v
+	case []any: // e.g. the message was unmarshaled from JSON
+		var calls []ToolCall
+		for _, c := range v {
+			c, _ := c.(map[string]any)
+			id, _ := c["id"].(string)
+			name, _ := c["name"].(string)
+			arguments, _ := c["arguments"].(string)
+			calls = append(calls, ToolCall{ID: id, Name: name, Arguments: arguments})
+		}
+		return calls
+	default:
+		return nil
+	}
+}
+
+// MalformedToolCallsError is returned by the models when the output format is JSON and the model generated
+// tool calls with malformed arguments in all the candidates, which [ai.Generate] would otherwise drop
+// for not matching the output schema.
+type MalformedToolCallsError struct {
+	// Calls are the tool calls of the first candidate.
+	Calls []ToolCall
+}
+
+func (e *MalformedToolCallsError) Error() string {
+	return fmt.Sprintf("the model generated %d tool calls with malformed arguments", len(e.Calls))
+}
+
+// malformedToolCallParts returns the text parts holding the tool calls with their raw arguments.
+func malformedToolCallParts(calls []ToolCall) []*ai.Part {
+	parts := make([]*ai.Part, len(calls))
+	for i, c := range calls {
+		parts[i] = ai.NewTextPart(fmt.Sprintf("called tool %s with malformed arguments: %s", c.Name, c.Arguments))
+	}
+	return parts
+}
+
+// refusalKey is the message metadata key for the refusal message of the model.
+const refusalKey = "refusal"
+
+// CandidateCustom is the OpenAI-specific data set in [ai.Candidate.Custom].
+type CandidateCustom struct {
+	// Logprobs holds the log probabilities of the output tokens if requested with [GenerationConfig.Logprobs].
+	Logprobs *Logprobs `json:"logprobs,omitempty"`
+	// Refusal is the refusal message if the model refused to answer.
+	// The candidate finishes with [ai.FinishReasonBlocked] and the refusal as FinishMessage in this case,
+	// and its message holds the refusal as text. If the output format is JSON, the refusal cannot match
+	// the output schema, so [ai.Generate] fails with a [*RefusalError] if the model refused in all the candidates.
+	Refusal string `json:"refusal,omitempty"`
+}
+
+// RefusalError is returned by the models when the output format is JSON and the model refused to answer
+// in all the candidates, which [ai.Generate] would otherwise drop for not matching the output schema.
+type RefusalError struct {
+	// Refusal is the refusal message of the first candidate.
+	Refusal string
+}
+
+func (e *RefusalError) Error() string {
+	return "the model refused to answer: " + e.Refusal
+}
+
+// ResponseCustom is the OpenAI-specific data set in [ai.GenerateResponse.Custom].
+type ResponseCustom struct {
+	// Model is the model that generated the response, as reported by OpenAI.
+	// It is the snapshot that the requested model or alias resolved to, e.g. "gpt-4o-2024-08-06".
+	Model string `json:"model,omitempty"`
+	// SystemFingerprint identifies the backend configuration the model ran with.
+	// Together with [GenerationConfig.Seed], it tells whether responses are expected to be reproducible.
+	SystemFingerprint string `json:"systemFingerprint,omitempty"`
+	// Cost is the cost of the request in USD, computed from the usage and the [Pricing] of the model.
+	// It is also added to the "openai/cost" OpenTelemetry counter, labelled by provider, model and,
+	// if it is set with [WithFlowName], flow.
+	// It is zero if the price of the model is unknown.
+	Cost float64 `json:"cost,omitempty"`
+	// Completion is the raw response of the API, which was set in [ai.GenerateResponse.Custom] before ResponseCustom.
+	// The completion of a streamed response is accumulated from its chunks.
+	Completion *goopenai.ChatCompletion `json:"completion,omitempty"`
+}
+
+// translateOptions are the options of a request that are needed to translate its response.
+type translateOptions struct {
+	// jsonMode is set if the output format is JSON.
+	jsonMode bool
+	// audioFormat is the format of the audio output, if requested.
+	audioFormat string
+}
+
+func translateResponse(resp *goopenai.ChatCompletion, opts translateOptions) *ai.GenerateResponse {
 	r := &ai.GenerateResponse{}
 
 	for _, c := range resp.Choices {
-		r.Candidates = append(r.Candidates, translateCandidate(c, jsonMode))
+		r.Candidates = append(r.Candidates, translateCandidate(c, opts))
 	}
 
-	r.Usage = &ai.GenerationUsage{
-		InputTokens:  int(resp.Usage.PromptTokens),
-		OutputTokens: int(resp.Usage.CompletionTokens),
-		TotalTokens:  int(resp.Usage.TotalTokens),
+	r.Usage = translateUsage(resp.Usage)
+	r.Custom = &ResponseCustom{
+		Model:             resp.Model,
+		SystemFingerprint: resp.SystemFingerprint,
+		Completion:        resp,
 	}
-	r.Custom = resp
 	return r
 }
 
-func translateCandidate(choice goopenai.ChatCompletionChoice, jsonMode bool) *ai.Candidate {
+func translateCandidate(choice goopenai.ChatCompletionChoice, opts translateOptions) *ai.Candidate {
 	c := &ai.Candidate{
 		Index: int(choice.Index),
 	}
@@ -39,25 +151,57 @@ func translateCandidate(choice goopenai.ChatCompletionChoice, jsonMode bool) *ai
 		c.FinishReason = ai.FinishReasonUnknown
 	}
 
+	custom := &CandidateCustom{
+		Logprobs: translateLogprobs(choice.Logprobs.Content, choice.Logprobs.Refusal),
+		Refusal:  choice.Message.Refusal,
+	}
+	if *custom != (CandidateCustom{}) {
+		c.Custom = custom
+	}
+
 	m := &ai.Message{
 		Role: ai.RoleModel,
 	}
 
-	// handle tool calls
-	var toolRequestParts []*ai.Part
-	for _, toolCall := range choice.Message.ToolCalls {
-		toolRequestParts = append(toolRequestParts, ai.NewToolRequestPart(&ai.ToolRequest{
-			Name:  toolCall.Function.Name,
-			Input: jsonStringToMap(toolCall.Function.Arguments),
-		}))
+	// The model refused to answer, e.g. when asked for structured outputs.
+	// The refusal is the only content in this case, also in JSON mode.
+	if choice.Message.Refusal != "" {
+		c.FinishReason = ai.FinishReasonBlocked
+		c.FinishMessage = choice.Message.Refusal
+		m.Content = []*ai.Part{ai.NewTextPart(choice.Message.Refusal)}
+		m.Metadata = map[string]any{refusalKey: choice.Message.Refusal}
+		c.Message = m
+		return c
 	}
-	if len(toolRequestParts) > 0 {
+
+	// handle tool calls
+	if len(choice.Message.ToolCalls) > 0 {
+		toolRequestParts, ok := translateToolCalls(choice.Message.ToolCalls)
+		if !ok {
+			if c.FinishReason != ai.FinishReasonLength {
+				c.FinishReason = ai.FinishReasonOther
+			}
+			c.FinishMessage = "the model generated tool call arguments that are not a valid JSON object"
+			calls := toolCalls(choice.Message.ToolCalls)
+			m.Content = malformedToolCallParts(calls)
+			m.Metadata = map[string]any{MalformedToolCallsKey: calls}
+			c.Message = m
+			return c
+		}
+		// Keep the tool call IDs so that they can be sent back with the tool responses.
+		ids := make([]string, len(choice.Message.ToolCalls))
+		for i, toolCall := range choice.Message.ToolCalls {
+			ids[i] = toolCall.ID
+		}
+		m.Metadata = map[string]any{toolCallIDsKey: ids}
 		m.Content = toolRequestParts
 		c.Message = m
 		return c
 	}
 
-	if jsonMode {
+	if audio := messageAudio(choice.Message); audio != nil {
+		translateAudio(m, audio, opts.audioFormat)
+	} else if opts.jsonMode {
 		m.Content = append(m.Content, ai.NewDataPart(choice.Message.Content))
 	} else {
 		m.Content = append(m.Content, ai.NewTextPart(choice.Message.Content))
@@ -66,3 +210,56 @@ func translateCandidate(choice goopenai.ChatCompletionChoice, jsonMode bool) *ai
 	c.Message = m
 	return c
 }
+
+// jsonOutputError returns an error if the output format of the request is JSON and none of the candidates
+// of the response can match the output schema, because the model refused to answer or generated malformed
+// tool calls: a [*RefusalError] or a [*MalformedToolCallsError] for the first candidate.
+func jsonOutputError(input *ai.GenerateRequest, resp *ai.GenerateResponse) error {
+	if input.Output == nil || input.Output.Format != ai.OutputFormatJSON || len(resp.Candidates) == 0 {
+		return nil
+	}
+	for _, c := range resp.Candidates {
+		if refusal(c) == "" && (c.Message == nil || len(MalformedToolCalls(c.Message)) == 0) {
+			return nil
+		}
+	}
+	c := resp.Candidates[0]
+	if r := refusal(c); r != "" {
+		return &RefusalError{Refusal: r}
+	}
+	return &MalformedToolCallsError{Calls: MalformedToolCalls(c.Message)}
+}
+
+// refusal returns the refusal message of the candidate, if the model refused to answer.
+func refusal(c *ai.Candidate) string {
+	if custom, ok := c.Custom.(*CandidateCustom); ok {
+		return custom.Refusal
+	}
+	return ""
+}
+
+// toolCalls returns the tool calls with their raw arguments.
+func toolCalls(calls []goopenai.ChatCompletionMessageToolCall) []ToolCall {
+	out := make([]ToolCall, len(calls))
+	for i, c := range calls {
+		out[i] = ToolCall{ID: c.ID, Name: c.Function.Name, Arguments: c.Function.Arguments}
+	}
+	return out
+}
+
+// translateToolCalls translates the tool calls to tool request parts.
+// It reports false if the arguments of any call are not a valid JSON object.
+func translateToolCalls(toolCalls []goopenai.ChatCompletionMessageToolCall) ([]*ai.Part, bool) {
+	var toolRequestParts []*ai.Part
+	for _, toolCall := range toolCalls {
+		input, err := jsonStringToMap(toolCall.Function.Arguments)
+		if err != nil {
+			return nil, false
+		}
+		toolRequestParts = append(toolRequestParts, ai.NewToolRequestPart(&ai.ToolRequest{
+			Name:  toolCall.Function.Name,
+			Input: input,
+		}))
+	}
+	return toolRequestParts, true
+}
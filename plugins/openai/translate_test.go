@@ -1,11 +1,18 @@
 package openai
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
 	"github.com/firebase/genkit/go/ai"
 	goopenai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
 )
 
 func TestTranslateCandidate(t *testing.T) {
@@ -82,7 +89,7 @@ func TestTranslateCandidate(t *testing.T) {
 						Content: "Tool call",
 						ToolCalls: []goopenai.ChatCompletionMessageToolCall{
 							{
-								ID:   "exampleTool",
+								ID:   "call_abc",
 								Type: goopenai.ChatCompletionMessageToolCallTypeFunction,
 								Function: goopenai.ChatCompletionMessageToolCallFunction{
 									Name:      "exampleTool",
@@ -106,18 +113,367 @@ func TestTranslateCandidate(t *testing.T) {
 							"param": "value",
 						},
 					})},
+					Metadata: map[string]any{
+						"toolCallIds": []string{"call_abc"},
+					},
+				},
+				Custom: nil,
+			},
+		},
+		{
+			name: "tools with malformed arguments",
+			input: struct {
+				choice   goopenai.ChatCompletionChoice
+				jsonMode bool
+			}{
+				choice: goopenai.ChatCompletionChoice{
+					Index: 0,
+					Message: goopenai.ChatCompletionMessage{
+						Role: goopenai.ChatCompletionMessageRoleAssistant,
+						ToolCalls: []goopenai.ChatCompletionMessageToolCall{
+							{
+								ID:   "call_abc",
+								Type: goopenai.ChatCompletionMessageToolCallTypeFunction,
+								Function: goopenai.ChatCompletionMessageToolCallFunction{
+									Name:      "exampleTool",
+									Arguments: "{\"param\": \"value\"}",
+								},
+							},
+							{
+								ID:   "call_def",
+								Type: goopenai.ChatCompletionMessageToolCallTypeFunction,
+								Function: goopenai.ChatCompletionMessageToolCallFunction{
+									Name:      "exampleTool",
+									Arguments: "{\"param\": \"val",
+								},
+							},
+						},
+					},
+					FinishReason: goopenai.ChatCompletionChoicesFinishReasonLength,
+				},
+				jsonMode: false,
+			},
+			want: &ai.Candidate{
+				Index:         0,
+				FinishReason:  ai.FinishReasonLength,
+				FinishMessage: "the model generated tool call arguments that are not a valid JSON object",
+				Message: &ai.Message{
+					Role: ai.RoleModel,
+					Content: []*ai.Part{
+						ai.NewTextPart("called tool exampleTool with malformed arguments: {\"param\": \"value\"}"),
+						ai.NewTextPart("called tool exampleTool with malformed arguments: {\"param\": \"val"),
+					},
+					Metadata: map[string]any{
+						MalformedToolCallsKey: []ToolCall{
+							{ID: "call_abc", Name: "exampleTool", Arguments: "{\"param\": \"value\"}"},
+							{ID: "call_def", Name: "exampleTool", Arguments: "{\"param\": \"val"},
+						},
+					},
 				},
 				Custom: nil,
 			},
 		},
+		{
+			name: "logprobs",
+			input: struct {
+				choice   goopenai.ChatCompletionChoice
+				jsonMode bool
+			}{
+				choice: goopenai.ChatCompletionChoice{
+					Index: 0,
+					Message: goopenai.ChatCompletionMessage{
+						Role:    goopenai.ChatCompletionMessageRoleAssistant,
+						Content: "Yes",
+					},
+					Logprobs: goopenai.ChatCompletionChoicesLogprobs{
+						Content: []goopenai.ChatCompletionTokenLogprob{
+							{
+								Token:   "Yes",
+								Logprob: -0.01,
+								Bytes:   []int64{89, 101, 115},
+								TopLogprobs: []goopenai.ChatCompletionTokenLogprobTopLogprob{
+									{Token: "Yes", Logprob: -0.01, Bytes: []int64{89, 101, 115}},
+									{Token: "No", Logprob: -4.6, Bytes: []int64{78, 111}},
+								},
+							},
+						},
+					},
+					FinishReason: goopenai.ChatCompletionChoicesFinishReasonStop,
+				},
+				jsonMode: false,
+			},
+			want: &ai.Candidate{
+				Index:        0,
+				FinishReason: ai.FinishReasonStop,
+				Message: &ai.Message{
+					Role:    ai.RoleModel,
+					Content: []*ai.Part{ai.NewTextPart("Yes")},
+				},
+				Custom: &CandidateCustom{
+					Logprobs: &Logprobs{
+						Content: []TokenLogprob{
+							{
+								Token:   "Yes",
+								Logprob: -0.01,
+								Bytes:   []int64{89, 101, 115},
+								TopLogprobs: []TopLogprob{
+									{Token: "Yes", Logprob: -0.01, Bytes: []int64{89, 101, 115}},
+									{Token: "No", Logprob: -4.6, Bytes: []int64{78, 111}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "refusal",
+			input: struct {
+				choice   goopenai.ChatCompletionChoice
+				jsonMode bool
+			}{
+				choice: goopenai.ChatCompletionChoice{
+					Index: 0,
+					Message: goopenai.ChatCompletionMessage{
+						Role:    goopenai.ChatCompletionMessageRoleAssistant,
+						Refusal: "I'm sorry, I cannot assist with that request.",
+					},
+					FinishReason: goopenai.ChatCompletionChoicesFinishReasonStop,
+				},
+				jsonMode: true,
+			},
+			want: &ai.Candidate{
+				Index:         0,
+				FinishReason:  ai.FinishReasonBlocked,
+				FinishMessage: "I'm sorry, I cannot assist with that request.",
+				Message: &ai.Message{
+					Role:     ai.RoleModel,
+					Content:  []*ai.Part{ai.NewTextPart("I'm sorry, I cannot assist with that request.")},
+					Metadata: map[string]any{refusalKey: "I'm sorry, I cannot assist with that request."},
+				},
+				Custom: &CandidateCustom{
+					Refusal: "I'm sorry, I cannot assist with that request.",
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := translateCandidate(tt.input.choice, tt.input.jsonMode)
+			got := translateCandidate(tt.input.choice, translateOptions{jsonMode: tt.input.jsonMode})
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("translateCandidate() = %#v, want %#v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestTranslateToolCalls(t *testing.T) {
+	toolCall := func(arguments string) goopenai.ChatCompletionMessageToolCall {
+		return goopenai.ChatCompletionMessageToolCall{
+			ID:   "call_abc",
+			Type: goopenai.ChatCompletionMessageToolCallTypeFunction,
+			Function: goopenai.ChatCompletionMessageToolCallFunction{
+				Name:      "tellAFunnyJoke",
+				Arguments: arguments,
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		input  string
+		want   map[string]any
+		wantOK bool
+	}{
+		{
+			name:   "arguments",
+			input:  `{"topic":"bob"}`,
+			want:   map[string]any{"topic": "bob"},
+			wantOK: true,
+		},
+		{
+			name:   "no arguments",
+			input:  "",
+			want:   nil,
+			wantOK: true,
+		},
+		{
+			name:   "truncated arguments",
+			input:  `{"topic":"bo`,
+			wantOK: false,
+		},
+		{
+			name:   "not an object",
+			input:  `["bob"]`,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := translateToolCalls([]goopenai.ChatCompletionMessageToolCall{toolCall(tt.input)})
+			if ok != tt.wantOK {
+				t.Fatalf("translateToolCalls() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			want := []*ai.Part{ai.NewToolRequestPart(&ai.ToolRequest{
+				Name:  "tellAFunnyJoke",
+				Input: tt.want,
+			})}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("translateToolCalls() = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestMalformedToolCalls(t *testing.T) {
+	want := []ToolCall{{ID: "call_abc", Name: "exampleTool", Arguments: `{"param": "val`}}
+	m := &ai.Message{Role: ai.RoleModel, Metadata: map[string]any{MalformedToolCallsKey: want}}
+	if got := MalformedToolCalls(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("MalformedToolCalls() = %#v, want %#v", got, want)
+	}
+
+	// The metadata of a message unmarshaled from JSON holds generic values.
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unmarshaled ai.Message
+	if err := json.Unmarshal(b, &unmarshaled); err != nil {
+		t.Fatal(err)
+	}
+	if got := MalformedToolCalls(&unmarshaled); !reflect.DeepEqual(got, want) {
+		t.Errorf("MalformedToolCalls() of an unmarshaled message = %#v, want %#v", got, want)
+	}
+}
+
+func TestGenerateMalformedToolCall(t *testing.T) {
+	type input struct {
+		Topic string `json:"topic"`
+	}
+	var called bool
+	tool := ai.DefineTool("test-malformed-tool", "Tell a joke.", func(ctx context.Context, in input) (string, error) {
+		called = true
+		return "joke", nil
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"created": 1,
+			"model": "gpt-4o-mini",
+			"choices": [{
+				"index": 0,
+				"message": {"role": "assistant", "content": null, "tool_calls": [{
+					"id": "call_abc",
+					"type": "function",
+					"function": {"name": "test-malformed-tool", "arguments": "{\"topic\": \"bo"}
+				}]},
+				"finish_reason": "length"
+			}],
+			"usage": {"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2}
+		}`)
+	}))
+	defer srv.Close()
+
+	p := &Plugin{
+		provider: "test-malformed",
+		client:   goopenai.NewClient(option.WithAPIKey("test"), option.WithBaseURL(srv.URL)),
+	}
+	p.mu.Lock()
+	m := p.defineModel("gpt-4o-mini", testModelInfo("gpt-4o-mini"))
+	p.mu.Unlock()
+
+	resp, err := ai.Generate(context.Background(), m, ai.WithTextPrompt("Tell a joke about bob."), ai.WithTools(tool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if called {
+		t.Error("the tool was run with malformed arguments")
+	}
+	c := resp.Candidates[0]
+	if c.FinishReason != ai.FinishReasonLength {
+		t.Errorf("finish reason = %q, want %q", c.FinishReason, ai.FinishReasonLength)
+	}
+	want := []ToolCall{{ID: "call_abc", Name: "test-malformed-tool", Arguments: `{"topic": "bo`}}
+	if got := MalformedToolCalls(c.Message); !reflect.DeepEqual(got, want) {
+		t.Errorf("MalformedToolCalls() = %#v, want %#v", got, want)
+	}
+
+	// The message can be sent back to ask the model again.
+	if _, err := convertMessages(append(resp.Request.Messages, c.Message)); err != nil {
+		t.Errorf("convertMessages() error = %v", err)
+	}
+
+	// In JSON mode, the candidates are not dropped silently.
+	_, err = ai.Generate(context.Background(), m,
+		ai.WithTextPrompt("Tell a joke about bob."),
+		ai.WithTools(tool),
+		ai.WithOutputSchema(&struct {
+			Joke string `json:"joke"`
+		}{}))
+	var malformed *MalformedToolCallsError
+	if !errors.As(err, &malformed) {
+		t.Fatalf("Generate() error = %v, want a MalformedToolCallsError", err)
+	}
+	if !reflect.DeepEqual(malformed.Calls, want) {
+		t.Errorf("MalformedToolCallsError.Calls = %#v, want %#v", malformed.Calls, want)
+	}
+}
+
+func TestGenerateRefusalJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"created": 1,
+			"model": "gpt-4o-mini",
+			"choices": [{
+				"index": 0,
+				"message": {"role": "assistant", "content": null, "refusal": "I'm sorry, I cannot assist with that request."},
+				"finish_reason": "stop"
+			}],
+			"usage": {"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2}
+		}`)
+	}))
+	defer srv.Close()
+
+	p := &Plugin{
+		provider: "test-refusal",
+		client:   goopenai.NewClient(option.WithAPIKey("test"), option.WithBaseURL(srv.URL)),
+	}
+	p.mu.Lock()
+	m := p.defineModel("gpt-4o-mini", testModelInfo("gpt-4o-mini"))
+	p.mu.Unlock()
+
+	// The refusal is returned as an error rather than dropped for not matching the output schema.
+	_, err := ai.Generate(context.Background(), m,
+		ai.WithTextPrompt("Tell a joke."),
+		ai.WithOutputSchema(&struct {
+			Joke string `json:"joke"`
+		}{}))
+	var refusal *RefusalError
+	if !errors.As(err, &refusal) {
+		t.Fatalf("Generate() error = %v, want a RefusalError", err)
+	}
+	if want := "I'm sorry, I cannot assist with that request."; refusal.Refusal != want {
+		t.Errorf("RefusalError.Refusal = %q, want %q", refusal.Refusal, want)
+	}
+
+	// Without an output schema, the candidate is blocked with the refusal as its finish message.
+	resp, err := ai.Generate(context.Background(), m, ai.WithTextPrompt("Tell a joke."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := resp.Candidates[0]
+	if c.FinishReason != ai.FinishReasonBlocked || c.FinishMessage != refusal.Refusal {
+		t.Errorf("candidate finishes with %q %q, want %q %q", c.FinishReason, c.FinishMessage, ai.FinishReasonBlocked, refusal.Refusal)
+	}
+}
@@ -0,0 +1,285 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/yukinagae/genkit-go-plugins/plugins/openai/internal/tokencount"
+)
+
+// Truncation trims the history of a request that does not fit the context window of the model.
+// It is called with the messages of the request and their token budget, and returns the messages to send.
+//
+// The truncations of this package only drop whole turns: a user message with the model messages
+// and tool responses that follow it, so that tool requests always stay with their responses.
+// The leading system messages and the last turn are always kept.
+type Truncation func(ctx context.Context, messages []*ai.Message, budget *Budget) ([]*ai.Message, error)
+
+// Budget is the number of tokens available to the messages of a request.
+// The tokens of each message are counted once, so that a [Truncation] can try many subsets of the messages.
+type Budget struct {
+	limit  int
+	count  func(*ai.Message) int
+	counts map[*ai.Message]int
+}
+
+// newBudget returns a budget of limit tokens for the messages, whose tokens are counted by count.
+func newBudget(limit int, count func(*ai.Message) int) *Budget {
+	return &Budget{limit: limit, count: count, counts: map[*ai.Message]int{}}
+}
+
+// Limit returns the number of tokens available to the messages.
+func (b *Budget) Limit() int {
+	return b.limit
+}
+
+// Count returns the number of tokens of the message.
+func (b *Budget) Count(m *ai.Message) int {
+	n, ok := b.counts[m]
+	if !ok {
+		n = b.count(m)
+		b.counts[m] = n
+	}
+	return n
+}
+
+// Fits reports whether the messages fit the budget.
+func (b *Budget) Fits(messages []*ai.Message) bool {
+	n := 0
+	for _, m := range messages {
+		n += b.Count(m)
+	}
+	return n <= b.limit
+}
+
+// DropOldest returns a [Truncation] that drops the oldest turns until the request fits.
+func DropOldest() Truncation {
+	return func(ctx context.Context, messages []*ai.Message, budget *Budget) ([]*ai.Message, error) {
+		system, turns := splitTurns(messages)
+		return joinTurns(system, turns[fittingTurns(system, turns, budget):]), nil
+	}
+}
+
+// KeepLastTurns returns a [Truncation] that keeps the system prompt and at most the last n turns,
+// dropping more of the oldest turns if they still do not fit.
+func KeepLastTurns(n int) Truncation {
+	return func(ctx context.Context, messages []*ai.Message, budget *Budget) ([]*ai.Message, error) {
+		system, turns := splitTurns(messages)
+		turns = turns[max(len(turns)-max(n, 1), 0):]
+		return joinTurns(system, turns[fittingTurns(system, turns, budget):]), nil
+	}
+}
+
+// summaryPrompt is the system prompt of the model summarizing the evicted turns.
+const summaryPrompt = "Summarize the following conversation between a user and an assistant. " +
+	"Keep the facts, decisions and open questions that the assistant needs to continue the conversation. " +
+	"Answer with the summary only."
+
+// summaryKey is the message metadata key marking the summary added by [Summarize].
+const summaryKey = "summary"
+
+// Summarize returns a [Truncation] that drops the oldest turns until the request fits, and replaces them
+// with a summary generated by the given model, sent as a system message after the system prompt.
+// For models without the system role, the summary is sent at the start of the first user message instead.
+// If the request does not fit with the summary, more of the oldest turns are dropped without being summarized.
+func Summarize(model ai.Model) Truncation {
+	return func(ctx context.Context, messages []*ai.Message, budget *Budget) ([]*ai.Message, error) {
+		system, turns := splitTurns(messages)
+		n := fittingTurns(system, turns, budget)
+		if n == 0 {
+			return messages, nil
+		}
+		resp, err := ai.Generate(ctx, model,
+			ai.WithSystemPrompt(summaryPrompt),
+			ai.WithTextPrompt(transcript(joinTurns(nil, turns[:n]))))
+		if err != nil {
+			return nil, fmt.Errorf("summarizing the conversation: %w", err)
+		}
+		summary := ai.NewSystemTextMessage("Summary of the earlier conversation:\n" + resp.Text())
+		summary.Metadata = map[string]any{summaryKey: true}
+		system = append(slices.Clip(system), summary)
+		turns = turns[n:]
+		return joinTurns(system, turns[fittingTurns(system, turns, budget):]), nil
+	}
+}
+
+// foldSummary moves the summary added by [Summarize], if any, to the start of the user message that follows it,
+// for models without the system role.
+func foldSummary(messages []*ai.Message) []*ai.Message {
+	i := slices.IndexFunc(messages, func(m *ai.Message) bool { return m.Metadata[summaryKey] == true })
+	if i < 0 {
+		return messages
+	}
+	summary := messages[i]
+	messages = slices.Delete(slices.Clone(messages), i, i+1)
+	j := slices.IndexFunc(messages[i:], func(m *ai.Message) bool { return m.Role == ai.RoleUser })
+	if j < 0 {
+		// The history has no user message after the summary, so the summary is sent as one.
+		user := *summary
+		user.Role = ai.RoleUser
+		return slices.Insert(messages, i, &user)
+	}
+	user := *messages[i+j]
+	user.Content = slices.Concat(summary.Content, user.Content)
+	messages[i+j] = &user
+	return messages
+}
+
+// splitTurns splits the messages into the leading system messages and the turns that follow.
+// Each turn starts with a user message, except the first one if the history starts with another role.
+func splitTurns(messages []*ai.Message) (system []*ai.Message, turns [][]*ai.Message) {
+	i := 0
+	for i < len(messages) && messages[i].Role == ai.RoleSystem {
+		i++
+	}
+	system = messages[:i]
+	for _, m := range messages[i:] {
+		if m.Role == ai.RoleUser || len(turns) == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], m)
+	}
+	return system, turns
+}
+
+// joinTurns returns the system messages followed by the messages of the turns.
+func joinTurns(system []*ai.Message, turns [][]*ai.Message) []*ai.Message {
+	messages := slices.Clone(system)
+	for _, t := range turns {
+		messages = append(messages, t...)
+	}
+	return messages
+}
+
+// fittingTurns returns the number of oldest turns to drop for the rest to fit the budget.
+// The last turn is always kept, even if it does not fit.
+func fittingTurns(system []*ai.Message, turns [][]*ai.Message, budget *Budget) int {
+	total := 0
+	for _, m := range system {
+		total += budget.Count(m)
+	}
+	turnTokens := make([]int, len(turns))
+	for i, t := range turns {
+		for _, m := range t {
+			turnTokens[i] += budget.Count(m)
+		}
+		total += turnTokens[i]
+	}
+	n := 0
+	for n < len(turns)-1 && total > budget.limit {
+		total -= turnTokens[n]
+		n++
+	}
+	return n
+}
+
+// transcript renders the messages as text, to be summarized by a model.
+func transcript(messages []*ai.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		for _, p := range m.Content {
+			switch {
+			case p.IsText():
+				fmt.Fprintf(&sb, "%s: %s\n", m.Role, p.Text)
+			case p.IsMedia():
+				fmt.Fprintf(&sb, "%s: [%s]\n", m.Role, p.ContentType)
+			case p.IsToolRequest():
+				input, _ := json.Marshal(p.ToolRequest.Input)
+				fmt.Fprintf(&sb, "%s: called tool %s with %s\n", m.Role, p.ToolRequest.Name, input)
+			case p.IsToolResponse():
+				output, _ := json.Marshal(p.ToolResponse.Output)
+				fmt.Fprintf(&sb, "%s: tool %s returned %s\n", m.Role, p.ToolResponse.Name, output)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// countTokens returns the number of input tokens of the request with the encoding of the model, described by info,
+// if the tokenizer package is imported, or an estimate otherwise.
+func countTokens(info ModelInfo, input *ai.GenerateRequest) int {
+	if count := tokencount.Get(); count != nil && info.Encoding != "" {
+		if n, err := count(info.Encoding, input.Messages, input.Tools); err == nil {
+			return n
+		}
+	}
+	return estimateTokens(input)
+}
+
+// Rough token counts used by estimateTokens.
+const (
+	charsPerToken       = 4
+	messageTokens       = 4
+	imageTokens         = 765
+	requestPrimerTokens = 3
+)
+
+// estimateTokens estimates the number of input tokens of the request.
+// It errs on the side of overestimating, since the model fails if the context window is exceeded.
+func estimateTokens(input *ai.GenerateRequest) int {
+	chars, tokens := 0, requestPrimerTokens
+	for _, m := range input.Messages {
+		tokens += messageTokens
+		for _, p := range m.Content {
+			switch {
+			case p.IsMedia():
+				tokens += imageTokens
+			case p.IsToolRequest():
+				b, _ := json.Marshal(p.ToolRequest)
+				chars += len(b)
+			case p.IsToolResponse():
+				b, _ := json.Marshal(p.ToolResponse)
+				chars += len(b)
+			default:
+				chars += len(p.Text)
+			}
+		}
+	}
+	for _, t := range input.Tools {
+		b, _ := json.Marshal(t)
+		chars += len(b)
+	}
+	return tokens + (chars+charsPerToken-1)/charsPerToken
+}
+
+// truncateRequest applies the truncation if the request does not fit the context window of the model,
+// described by info, leaving room for GenerationConfig.MaxOutputTokens.
+// Models without a known context window are not truncated.
+// It returns a copy of the request if it is truncated.
+func truncateRequest(ctx context.Context, model string, info ModelInfo, input *ai.GenerateRequest, truncation Truncation) (*ai.GenerateRequest, error) {
+	if truncation == nil || info.ContextWindow == 0 {
+		return input, nil
+	}
+	c, err := generationConfig(input.Config)
+	if err != nil {
+		return nil, err
+	}
+	// The tokens of the request are the tokens of the request without messages, e.g. of its tools,
+	// plus the tokens of each message, so that the messages are counted once.
+	empty := *input
+	empty.Messages = nil
+	fixed := countTokens(info, &empty)
+	empty.Tools = nil
+	base := countTokens(info, &empty)
+	budget := newBudget(info.ContextWindow-c.MaxOutputTokens-fixed, func(m *ai.Message) int {
+		r := ai.GenerateRequest{Messages: []*ai.Message{m}}
+		return countTokens(info, &r) - base
+	})
+	if budget.Fits(input.Messages) {
+		return input, nil
+	}
+	messages, err := truncation(ctx, input.Messages, budget)
+	if err != nil {
+		return nil, fmt.Errorf("truncating the request to the context window of %q: %w", model, err)
+	}
+	if !info.Supports.SystemRole {
+		messages = foldSummary(messages)
+	}
+	r := *input
+	r.Messages = messages
+	return &r, nil
+}
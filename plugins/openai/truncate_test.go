@@ -0,0 +1,215 @@
+package openai
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/yukinagae/genkit-go-plugins/plugins/openai/internal/tokencount"
+)
+
+func TestTruncation(t *testing.T) {
+	system := ai.NewSystemTextMessage("You are a helpful assistant.")
+	user1 := ai.NewUserTextMessage("What's the weather in Tokyo?")
+	toolRequest := ai.NewModelMessage(ai.NewToolRequestPart(&ai.ToolRequest{Name: "weather", Input: map[string]any{"city": "Tokyo"}}))
+	toolResponse := &ai.Message{Role: ai.RoleTool, Content: []*ai.Part{ai.NewToolResponsePart(&ai.ToolResponse{Name: "weather", Output: map[string]any{"response": "sunny"}})}}
+	model1 := ai.NewModelTextMessage("It's sunny.")
+	user2 := ai.NewUserTextMessage("And in Paris?")
+	model2 := ai.NewModelTextMessage("It's rainy.")
+	user3 := ai.NewUserTextMessage("Thanks!")
+	messages := []*ai.Message{system, user1, toolRequest, toolResponse, model1, user2, model2, user3}
+
+	// maxMessages returns a budget of n messages.
+	maxMessages := func(n int) *Budget {
+		return newBudget(n, func(*ai.Message) int { return 1 })
+	}
+
+	tests := []struct {
+		name       string
+		truncation Truncation
+		budget     *Budget
+		want       []*ai.Message
+	}{
+		{
+			name:       "drop oldest keeps tool pairs together",
+			truncation: DropOldest(),
+			budget:     maxMessages(6),
+			want:       []*ai.Message{system, user2, model2, user3},
+		},
+		{
+			name:       "drop oldest keeps the last turn",
+			truncation: DropOldest(),
+			budget:     maxMessages(0),
+			want:       []*ai.Message{system, user3},
+		},
+		{
+			name:       "drop oldest fits",
+			truncation: DropOldest(),
+			budget:     maxMessages(8),
+			want:       messages,
+		},
+		{
+			name:       "keep last turns",
+			truncation: KeepLastTurns(2),
+			budget:     maxMessages(8),
+			want:       []*ai.Message{system, user2, model2, user3},
+		},
+		{
+			name:       "keep last turns drops more if needed",
+			truncation: KeepLastTurns(2),
+			budget:     maxMessages(3),
+			want:       []*ai.Message{system, user3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.truncation(context.Background(), messages, tt.budget)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("truncation() = %v, want %v", transcript(got), transcript(tt.want))
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var gotPrompt string
+	summarizer := ai.DefineModel("test", "summarizer", nil, func(ctx context.Context, req *ai.GenerateRequest, cb ai.ModelStreamingCallback) (*ai.GenerateResponse, error) {
+		gotPrompt = req.Messages[len(req.Messages)-1].Content[0].Text
+		return &ai.GenerateResponse{
+			Request: req,
+			Candidates: []*ai.Candidate{{
+				FinishReason: ai.FinishReasonStop,
+				Message:      ai.NewModelTextMessage("The user asked about the weather."),
+			}},
+		}, nil
+	})
+
+	system := ai.NewSystemTextMessage("You are a helpful assistant.")
+	user1 := ai.NewUserTextMessage("What's the weather in Tokyo?")
+	model1 := ai.NewModelTextMessage("It's sunny.")
+	user2 := ai.NewUserTextMessage("Thanks!")
+	messages := []*ai.Message{system, user1, model1, user2}
+
+	got, err := Summarize(summarizer)(context.Background(), messages, newBudget(3, func(*ai.Message) int { return 1 }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := ai.NewSystemTextMessage("Summary of the earlier conversation:\nThe user asked about the weather.")
+	summary.Metadata = map[string]any{summaryKey: true}
+	want := []*ai.Message{system, summary, user2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Summarize() = %v, want %v", transcript(got), transcript(want))
+	}
+	if wantPrompt := "user: What's the weather in Tokyo?\nmodel: It's sunny.\n"; gotPrompt != wantPrompt {
+		t.Errorf("summarized transcript = %q, want %q", gotPrompt, wantPrompt)
+	}
+}
+
+func TestFoldSummary(t *testing.T) {
+	summary := ai.NewSystemTextMessage("Summary of the earlier conversation:\nThe user asked about the weather.")
+	summary.Metadata = map[string]any{summaryKey: true}
+	user := ai.NewUserTextMessage("Thanks!")
+	model := ai.NewModelTextMessage("You're welcome.")
+
+	got := foldSummary([]*ai.Message{summary, user})
+	want := []*ai.Message{ai.NewUserMessage(summary.Content[0], user.Content[0])}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("foldSummary() = %v, want %v", transcript(got), transcript(want))
+	}
+	if len(user.Content) != 1 {
+		t.Error("foldSummary() modified the user message")
+	}
+
+	got = foldSummary([]*ai.Message{summary, model})
+	want = []*ai.Message{{Role: ai.RoleUser, Content: summary.Content, Metadata: summary.Metadata}, model}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("foldSummary() without a user message = %v, want %v", transcript(got), transcript(want))
+	}
+}
+
+func TestTruncateRequestTokenCounter(t *testing.T) {
+	var gotEncoding string
+	counted := map[*ai.Message]int{}
+	tokencount.Set(func(encoding string, messages []*ai.Message, tools []*ai.ToolDefinition) (int, error) {
+		gotEncoding = encoding
+		for _, m := range messages {
+			counted[m]++
+		}
+		// Each message is as large as the context window.
+		return len(messages) * 8192, nil
+	})
+	t.Cleanup(func() { tokencount.Set(nil) })
+
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			ai.NewUserTextMessage("Hello"),
+			ai.NewModelTextMessage("Hi"),
+			ai.NewUserTextMessage("Bye"),
+		},
+	}
+	got, err := truncateRequest(context.Background(), "gpt-4", testModelInfo("gpt-4"), input, DropOldest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := input.Messages[2:]; !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("truncateRequest() kept %d messages, want %d", len(got.Messages), len(want))
+	}
+	if gotEncoding != "cl100k_base" {
+		t.Errorf("tokens counted with encoding %q, want %q", gotEncoding, "cl100k_base")
+	}
+	for i, m := range input.Messages {
+		if counted[m] != 1 {
+			t.Errorf("message %d counted %d times, want 1", i, counted[m])
+		}
+	}
+}
+
+func TestTruncateRequest(t *testing.T) {
+	// gpt-4 has a context window of 8192 tokens, and each message has about 2500 tokens.
+	long := strings.Repeat("a", 10000)
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			ai.NewUserTextMessage(long),
+			ai.NewModelTextMessage(long),
+			ai.NewUserTextMessage(long),
+			ai.NewModelTextMessage(long),
+			ai.NewUserTextMessage("Hello"),
+		},
+	}
+
+	got, err := truncateRequest(context.Background(), "gpt-4", testModelInfo("gpt-4"), input, DropOldest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := input.Messages[2:]; !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("truncateRequest() kept %d messages, want %d", len(got.Messages), len(want))
+	}
+	if len(input.Messages) != 5 {
+		t.Errorf("truncateRequest() modified the input")
+	}
+
+	// Room is left for the output tokens.
+	input.Config = &ai.GenerationCommonConfig{MaxOutputTokens: 4000}
+	got, err = truncateRequest(context.Background(), "gpt-4", testModelInfo("gpt-4"), input, DropOldest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := input.Messages[4:]; !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("truncateRequest() kept %d messages, want %d", len(got.Messages), len(want))
+	}
+
+	// Models with an unknown context window are not truncated.
+	got, err = truncateRequest(context.Background(), "my-model", testModelInfo("my-model"), input, DropOldest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != input {
+		t.Errorf("truncateRequest() truncated a model with an unknown context window")
+	}
+}
@@ -0,0 +1,90 @@
+package openai
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+)
+
+// Keys of the detailed token counts in [ai.GenerationUsage.Custom].
+const (
+	// UsageCachedInputTokens is the number of input tokens read from the prompt cache.
+	UsageCachedInputTokens = "cachedInputTokens"
+	// UsageInputAudioTokens is the number of input tokens used for audio.
+	UsageInputAudioTokens = "inputAudioTokens"
+	// UsageReasoningTokens is the number of reasoning tokens generated by reasoning models.
+	// Reasoning tokens are not visible in the output, but they are counted in the output tokens.
+	UsageReasoningTokens = "reasoningTokens"
+	// UsageOutputAudioTokens is the number of output tokens used for audio.
+	UsageOutputAudioTokens = "outputAudioTokens"
+)
+
+// usageDetails are the details of the token counts, which are not supported by goopenai yet.
+type usageDetails struct {
+	CachedTokens    int64 `json:"cached_tokens"`
+	AudioTokens     int64 `json:"audio_tokens"`
+	ReasoningTokens int64 `json:"reasoning_tokens"`
+}
+
+func translateUsage(usage goopenai.CompletionUsage) *ai.GenerationUsage {
+	u := &ai.GenerationUsage{
+		InputTokens:  int(usage.PromptTokens),
+		OutputTokens: int(usage.CompletionTokens),
+		TotalTokens:  int(usage.TotalTokens),
+	}
+
+	var prompt, completion usageDetails
+	// The details are missing for some models, in which case they are ignored.
+	_ = json.Unmarshal([]byte(usage.JSON.ExtraFields["prompt_tokens_details"].Raw()), &prompt)
+	_ = json.Unmarshal([]byte(usage.JSON.ExtraFields["completion_tokens_details"].Raw()), &completion)
+	custom := map[string]float64{}
+	for key, n := range map[string]int64{
+		UsageCachedInputTokens: prompt.CachedTokens,
+		UsageInputAudioTokens:  prompt.AudioTokens,
+		UsageReasoningTokens:   completion.ReasoningTokens,
+		UsageOutputAudioTokens: completion.AudioTokens,
+	} {
+		if n > 0 {
+			custom[key] = float64(n)
+		}
+	}
+	if len(custom) > 0 {
+		u.Custom = custom
+	}
+	return u
+}
+
+// countCharactersAndImages sets the number of characters and images of the request and its response in the usage.
+func countCharactersAndImages(r *ai.GenerateResponse, input *ai.GenerateRequest) {
+	if r.Usage == nil {
+		r.Usage = &ai.GenerationUsage{}
+	}
+	for _, m := range input.Messages {
+		chars, images := countParts(m.Content)
+		r.Usage.InputCharacters += chars
+		r.Usage.InputImages += images
+	}
+	for _, c := range r.Candidates {
+		if c.Message == nil {
+			continue
+		}
+		chars, images := countParts(c.Message.Content)
+		r.Usage.OutputCharacters += chars
+		r.Usage.OutputImages += images
+	}
+}
+
+// countParts returns the number of characters of the text parts and the number of images.
+func countParts(parts []*ai.Part) (chars, images int) {
+	for _, p := range parts {
+		switch {
+		case p.IsText():
+			chars += utf8.RuneCountInString(p.Text)
+		case isImage(p):
+			images++
+		}
+	}
+	return chars, images
+}
@@ -0,0 +1,119 @@
+package openai
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	goopenai "github.com/openai/openai-go"
+)
+
+func TestTranslateUsage(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *ai.GenerationUsage
+	}{
+		{
+			name:  "without details",
+			input: `{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}`,
+			want: &ai.GenerationUsage{
+				InputTokens:  10,
+				OutputTokens: 5,
+				TotalTokens:  15,
+			},
+		},
+		{
+			name: "with details",
+			input: `{
+				"prompt_tokens": 2000,
+				"completion_tokens": 500,
+				"total_tokens": 2500,
+				"prompt_tokens_details": {"cached_tokens": 1024, "audio_tokens": 100},
+				"completion_tokens_details": {"reasoning_tokens": 300, "audio_tokens": 50}
+			}`,
+			want: &ai.GenerationUsage{
+				InputTokens:  2000,
+				OutputTokens: 500,
+				TotalTokens:  2500,
+				Custom: map[string]float64{
+					UsageCachedInputTokens: 1024,
+					UsageInputAudioTokens:  100,
+					UsageReasoningTokens:   300,
+					UsageOutputAudioTokens: 50,
+				},
+			},
+		},
+		{
+			name: "zero details",
+			input: `{
+				"prompt_tokens": 10,
+				"completion_tokens": 5,
+				"total_tokens": 15,
+				"prompt_tokens_details": {"cached_tokens": 0},
+				"completion_tokens_details": {"reasoning_tokens": 0}
+			}`,
+			want: &ai.GenerationUsage{
+				InputTokens:  10,
+				OutputTokens: 5,
+				TotalTokens:  15,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var usage goopenai.CompletionUsage
+			if err := json.Unmarshal([]byte(tt.input), &usage); err != nil {
+				t.Fatal(err)
+			}
+			got := translateUsage(usage)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("translateUsage() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountCharactersAndImages(t *testing.T) {
+	input := &ai.GenerateRequest{
+		Messages: []*ai.Message{
+			{
+				Role:    ai.RoleSystem,
+				Content: []*ai.Part{ai.NewTextPart("Be nice.")},
+			},
+			{
+				Role: ai.RoleUser,
+				Content: []*ai.Part{
+					ai.NewTextPart("Describe these images: 日本"),
+					ai.NewMediaPart("image/jpeg", "https://example.com/image.jpg"),
+					ai.NewMediaPart("", "data:image/png;base64,iVBORw0KGgo="),
+					ai.NewMediaPart("audio/wav", "UklGRg=="),
+				},
+			},
+		},
+	}
+	r := &ai.GenerateResponse{
+		Candidates: []*ai.Candidate{
+			{
+				Message: &ai.Message{
+					Role:    ai.RoleModel,
+					Content: []*ai.Part{ai.NewTextPart("A cat and a dog.")},
+				},
+			},
+		},
+		Usage: &ai.GenerationUsage{InputTokens: 100},
+	}
+
+	countCharactersAndImages(r, input)
+	want := &ai.GenerationUsage{
+		InputTokens:      100,
+		InputCharacters:  8 + 25,
+		InputImages:      2,
+		OutputCharacters: 16,
+	}
+	if !reflect.DeepEqual(r.Usage, want) {
+		t.Errorf("usage = %#v, want %#v", r.Usage, want)
+	}
+}
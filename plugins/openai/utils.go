@@ -5,18 +5,24 @@ import (
 	"fmt"
 )
 
-func jsonStringToMap(jsonString string) map[string]any {
+// jsonStringToMap parses a JSON object.
+// An empty string is parsed as a nil map.
+func jsonStringToMap(jsonString string) (map[string]any, error) {
+	if jsonString == "" {
+		return nil, nil
+	}
 	var result map[string]any
 	if err := json.Unmarshal([]byte(jsonString), &result); err != nil {
-		panic(fmt.Errorf("unmarshal failed to parse json string %s: %w", jsonString, err))
+		return nil, fmt.Errorf("unmarshal failed to parse json string %s: %w", jsonString, err)
 	}
-	return result
+	return result, nil
 }
 
-func mapToJSONString(data map[string]any) string {
+// toJSONString marshals any JSON-serializable value, e.g. a map, a slice or a scalar.
+func toJSONString(data any) (string, error) {
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
-		panic(fmt.Errorf("failed to marshal map to JSON string: data, %#v %w", data, err))
+		return "", fmt.Errorf("failed to marshal to JSON string: data, %#v %w", data, err)
 	}
-	return string(jsonBytes)
+	return string(jsonBytes), nil
 }
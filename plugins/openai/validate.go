@@ -0,0 +1,89 @@
+package openai
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Capabilities reported by [UnsupportedCapabilityError].
+const (
+	CapabilityMultiturn    = "multiturn"
+	CapabilityTools        = "tools"
+	CapabilityMedia        = "media"
+	CapabilitySystemRole   = "systemRole"
+	CapabilityOutputFormat = "outputFormat"
+)
+
+// UnsupportedCapabilityError is returned when a request needs a capability that the model does not have.
+// The request is not sent to OpenAI in this case.
+type UnsupportedCapabilityError struct {
+	// Model is the name of the model.
+	Model string
+	// Capability is the missing capability, e.g. [CapabilityMedia].
+	Capability string
+	// Reason tells which part of the request needs the capability.
+	Reason string
+}
+
+func (e *UnsupportedCapabilityError) Error() string {
+	return fmt.Sprintf("model %q does not support %s: %s", e.Model, e.Capability, e.Reason)
+}
+
+// validateRequest checks the request against the capabilities of the model, described by info,
+// so that unsupported requests fail before they are sent.
+func validateRequest(model string, info ModelInfo, input *ai.GenerateRequest) error {
+	caps := info.Supports
+	unsupported := func(capability, format string, args ...any) error {
+		return &UnsupportedCapabilityError{Model: model, Capability: capability, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	turns := 0
+	for i, m := range input.Messages {
+		if m.Role == ai.RoleSystem {
+			if !caps.SystemRole {
+				return unsupported(CapabilitySystemRole, "message %d is a system message", i)
+			}
+		} else {
+			turns++
+		}
+		if !caps.Multiturn && turns > 1 {
+			return unsupported(CapabilityMultiturn, "the request has more than one message besides the system message")
+		}
+		for _, p := range m.Content {
+			switch {
+			case isAudio(p):
+				// Audio generated by the model is not sent back, so it is only checked in user messages.
+				if m.Role == ai.RoleUser && !info.supportsInput(ModalityAudio) {
+					return unsupported(CapabilityMedia, "message %d has audio of type %q", i, p.ContentType)
+				}
+			case p.IsMedia():
+				// The models whose input modalities are unknown are only checked against Supports.Media.
+				if !caps.Media || len(info.InputModalities) > 0 && !info.supportsInput(ModalityImage) {
+					return unsupported(CapabilityMedia, "message %d has a media part of type %q", i, p.ContentType)
+				}
+			}
+			if !caps.Tools && (p.IsToolRequest() || p.IsToolResponse()) {
+				return unsupported(CapabilityTools, "message %d has a tool request or response", i)
+			}
+		}
+	}
+	if !caps.Tools && len(input.Tools) > 0 {
+		return unsupported(CapabilityTools, "the request has %d tools", len(input.Tools))
+	}
+
+	if input.Output != nil {
+		switch input.Output.Format {
+		case "", ai.OutputFormatText, ai.OutputFormatJSON:
+		case ai.OutputFormatMedia:
+			// Audio is the only media generated by chat models. The models whose output modalities are unknown are not checked.
+			if len(info.OutputModalities) > 0 && !slices.Contains(info.OutputModalities, ModalityAudio) {
+				return unsupported(CapabilityOutputFormat, "the model does not generate media")
+			}
+		default:
+			return unsupported(CapabilityOutputFormat, "unknown output format %q", input.Output.Format)
+		}
+	}
+	return nil
+}
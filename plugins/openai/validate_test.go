@@ -0,0 +1,138 @@
+package openai
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestValidateRequest(t *testing.T) {
+	system := ai.NewSystemTextMessage("You are a helpful assistant.")
+	user := ai.NewUserTextMessage("Hello")
+	image := ai.NewUserMessage(ai.NewMediaPart("image/png", "data:image/png;base64,iVBORw0KGgo="))
+	audio := ai.NewUserMessage(ai.NewMediaPart("audio/wav", "data:audio/wav;base64,UklGRg=="))
+	toolRequest := ai.NewModelMessage(ai.NewToolRequestPart(&ai.ToolRequest{Name: "weather"}))
+	tool := &ai.ToolDefinition{Name: "weather"}
+
+	tests := []struct {
+		name           string
+		model          string
+		caps           ai.ModelCapabilities
+		input          *ai.GenerateRequest
+		wantCapability string
+	}{
+		{
+			name:  "supported",
+			model: "gpt-4o",
+			caps:  Multimodal,
+			input: &ai.GenerateRequest{
+				Messages: []*ai.Message{system, image, toolRequest},
+				Tools:    []*ai.ToolDefinition{tool},
+				Output:   &ai.GenerateRequestOutput{Format: ai.OutputFormatJSON},
+			},
+		},
+		{
+			name:           "media",
+			model:          "gpt-4",
+			caps:           BasicText,
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{image}},
+			wantCapability: CapabilityMedia,
+		},
+		{
+			name:           "tool definitions",
+			model:          "my-model",
+			caps:           ai.ModelCapabilities{Multiturn: true},
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{user}, Tools: []*ai.ToolDefinition{tool}},
+			wantCapability: CapabilityTools,
+		},
+		{
+			name:           "tool requests",
+			model:          "my-model",
+			caps:           ai.ModelCapabilities{Multiturn: true},
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{user, toolRequest}},
+			wantCapability: CapabilityTools,
+		},
+		{
+			name:           "system role",
+			model:          "my-model",
+			caps:           ai.ModelCapabilities{},
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{system, user}},
+			wantCapability: CapabilitySystemRole,
+		},
+		{
+			name:  "single turn with system message",
+			model: "my-model",
+			caps:  ai.ModelCapabilities{SystemRole: true},
+			input: &ai.GenerateRequest{Messages: []*ai.Message{system, user}},
+		},
+		{
+			name:           "multiturn",
+			model:          "my-model",
+			caps:           ai.ModelCapabilities{SystemRole: true},
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{system, user, user}},
+			wantCapability: CapabilityMultiturn,
+		},
+		{
+			name:  "audio",
+			model: "gpt-4o-audio-preview",
+			caps:  Audio,
+			input: &ai.GenerateRequest{Messages: []*ai.Message{audio}},
+		},
+		{
+			name:           "image to an audio model",
+			model:          "gpt-4o-audio-preview",
+			caps:           Audio,
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{image}},
+			wantCapability: CapabilityMedia,
+		},
+		{
+			name:           "audio to an image model",
+			model:          "gpt-4o",
+			caps:           Multimodal,
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{audio}},
+			wantCapability: CapabilityMedia,
+		},
+		{
+			name:  "media output",
+			model: "gpt-4o-audio-preview",
+			caps:  Audio,
+			input: &ai.GenerateRequest{Messages: []*ai.Message{user}, Output: &ai.GenerateRequestOutput{Format: ai.OutputFormatMedia}},
+		},
+		{
+			name:           "unsupported media output",
+			model:          "gpt-4o",
+			caps:           Multimodal,
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{user}, Output: &ai.GenerateRequestOutput{Format: ai.OutputFormatMedia}},
+			wantCapability: CapabilityOutputFormat,
+		},
+		{
+			name:           "unknown output format",
+			model:          "gpt-4o",
+			caps:           Multimodal,
+			input:          &ai.GenerateRequest{Messages: []*ai.Message{user}, Output: &ai.GenerateRequestOutput{Format: "yaml"}},
+			wantCapability: CapabilityOutputFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := testModelInfo(tt.model)
+			info.Supports = tt.caps
+			err := validateRequest(tt.model, info, tt.input)
+			if tt.wantCapability == "" {
+				if err != nil {
+					t.Errorf("validateRequest() error = %v", err)
+				}
+				return
+			}
+			var capErr *UnsupportedCapabilityError
+			if !errors.As(err, &capErr) {
+				t.Fatalf("validateRequest() error = %v, want an UnsupportedCapabilityError", err)
+			}
+			if capErr.Model != tt.model || capErr.Capability != tt.wantCapability {
+				t.Errorf("validateRequest() error = %#v, want model %q and capability %q", capErr, tt.model, tt.wantCapability)
+			}
+		})
+	}
+}